@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Audit actions recorded against a user's account. They are kept for the
+// lifetime of the account and included in data exports.
+const (
+	auditLogin              = "login"
+	auditLoginFailed        = "login_failed"
+	auditPasswordChanged    = "password_changed"
+	auditPasswordReset      = "password_reset"
+	auditEmailChangeStarted = "email_change_requested"
+	auditTOTPEnabled        = "2fa_enabled"
+	auditSessionRevoked     = "session_revoked"
+	auditLogoutAll          = "logout_all"
+	auditAPIKeyCreated      = "api_key_created"
+	auditAPIKeyDeleted      = "api_key_deleted"
+	auditOAuthConsent       = "oauth_consent_granted"
+	auditRoleChanged        = "role_changed"
+	auditDeletionRequested  = "account_deletion_requested"
+	auditDeletionCancelled  = "account_deletion_cancelled"
+	auditExportRequested    = "data_export_requested"
+)
+
+// recordAudit stores an audit event for userID. Like login failures, a
+// failure to record one is logged but never fails the request.
+func (cfg *apiConfig) recordAudit(r *http.Request, userID uuid.UUID, action, detail string) {
+	err := cfg.db.CreateAuditEvent(r.Context(), database.CreateAuditEventParams{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Action:    action,
+		Detail:    detail,
+		Ip:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		log.Printf("couldn't record %s audit event: %v", action, err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// cursor marks the last item of a page. It is handed to clients as an
+// opaque string and only ever decoded by decodeCursor.
+type cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, fmt.Errorf("couldn't decode cursor: %v", err)
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return cursor{}, errors.New("malformed cursor")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return cursor{}, fmt.Errorf("couldn't parse cursor time: %v", err)
+	}
+
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return cursor{}, fmt.Errorf("couldn't parse cursor id: %v", err)
+	}
+
+	return cursor{CreatedAt: t, ID: parsedID}, nil
+}
+
+func parsePageLimit(s string) (int32, error) {
+	if s == "" {
+		return defaultPageLimit, nil
+	}
+
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	return int32(limit), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.FixedZone("CEST", 2*60*60))
+	id := uuid.New()
+
+	got, err := decodeCursor(encodeCursor(createdAt, id))
+	if err != nil {
+		t.Fatalf("decodeCursor() error = %v", err)
+	}
+	if !got.CreatedAt.Equal(createdAt) || got.ID != id {
+		t.Errorf("decodeCursor() = %+v, want %v and %v", got, createdAt, id)
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	id := uuid.New()
+
+	tests := []struct {
+		name    string
+		cursor  string
+		wantErr bool
+	}{
+		{
+			name:    "Valid cursor",
+			cursor:  encode("2024-05-01T12:30:00.5Z|" + id.String()),
+			wantErr: false,
+		},
+		{
+			name:    "Malformed base64",
+			cursor:  "not base64!",
+			wantErr: true,
+		},
+		{
+			name:    "Missing separator",
+			cursor:  encode("2024-05-01T12:30:00Z" + id.String()),
+			wantErr: true,
+		},
+		{
+			name:    "Bad time",
+			cursor:  encode("yesterday|" + id.String()),
+			wantErr: true,
+		},
+		{
+			name:    "Bad id",
+			cursor:  encode("2024-05-01T12:30:00Z|not-a-uuid"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeCursor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParsePageLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   string
+		want    int32
+		wantErr bool
+	}{
+		{name: "Default", limit: "", want: defaultPageLimit},
+		{name: "Within range", limit: "10", want: 10},
+		{name: "At the maximum", limit: "100", want: maxPageLimit},
+		{name: "Clamped to the maximum", limit: "1000", want: maxPageLimit},
+		{name: "Zero", limit: "0", wantErr: true},
+		{name: "Negative", limit: "-5", wantErr: true},
+		{name: "Not a number", limit: "ten", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePageLimit(tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePageLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePageLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
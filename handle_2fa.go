@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/deexth/chirpy/internal/auth"
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/deexth/chirpy/internal/throttle"
+	"github.com/google/uuid"
+)
+
+const recoveryCodeCount = 10
+
+func (cfg *apiConfig) handle2FASetup(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	numAffectedRows, err := cfg.db.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	if numAffectedRows == 0 {
+		respondWithError(w, http.StatusConflict, "two-factor authentication is already enabled", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI("Chirpy", user.Email, secret),
+	})
+}
+
+func (cfg *apiConfig) handle2FAVerify(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	userID := requestUserID(r)
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "two-factor authentication is already enabled", nil)
+		return
+	}
+
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "two-factor setup has not been started", nil)
+		return
+	}
+
+	if err := cfg.checkTOTP(r, user, params.Code); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "invalid code", err)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	if err := cfg.db.DeleteUserRecoveryCodes(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	for _, code := range codes {
+		err := cfg.db.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashToken(code),
+			UserID:   user.ID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+	}
+
+	// Enable last so a failure above never leaves 2FA on without a way
+	// to recover.
+	if _, err := cfg.db.EnableUserTOTP(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	cfg.recordAudit(r, user.ID, auditTOTPEnabled, "")
+
+	respondWithJSON(w, http.StatusOK, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	})
+}
+
+// handleLoginMFA finishes a login started by handleLogin by exchanging
+// the MFA challenge token and a TOTP or recovery code for a session.
+func (cfg *apiConfig) handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	userID, err := cfg.keyring.ValidateMFAToken(params.MFAToken)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", errors.New("two-factor authentication not enabled"))
+		return
+	}
+
+	throttleKeys := []throttle.Key{throttle.SecondFactorKey(user.ID), throttle.IPKey(clientIP(r))}
+	retryAfter, err := cfg.throttle.Reserve(r.Context(), throttleKeys...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+	if retryAfter > 0 {
+		respondWithRetryAfter(w, retryAfter)
+		return
+	}
+
+	switch {
+	case params.Code != "":
+		err = cfg.checkTOTP(r, user, params.Code)
+	case params.RecoveryCode != "":
+		err = cfg.useRecoveryCode(r, user.ID, params.RecoveryCode)
+	default:
+		err = errors.New("no code provided")
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "invalid code", err)
+		return
+	}
+
+	if err := cfg.throttle.Reset(r.Context(), throttle.SecondFactorKey(user.ID)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+	if err := cfg.throttle.Release(r.Context(), throttle.IPKey(clientIP(r))); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
+
+// checkTOTP validates code against the user's secret and records the
+// matched time step so the same code can't be replayed.
+func (cfg *apiConfig) checkTOTP(r *http.Request, user database.User, code string) error {
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+	if !ok {
+		return errors.New("totp code mismatch")
+	}
+
+	numAffectedRows, err := cfg.db.RecordUserTOTPStep(r.Context(), database.RecordUserTOTPStepParams{
+		ID:           user.ID,
+		TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	if numAffectedRows == 0 {
+		return errors.New("totp code already used")
+	}
+
+	return nil
+}
+
+func (cfg *apiConfig) useRecoveryCode(r *http.Request, userID uuid.UUID, code string) error {
+	numAffectedRows, err := cfg.db.UseRecoveryCode(r.Context(), database.UseRecoveryCodeParams{
+		CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+		UserID:   userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if numAffectedRows == 0 {
+		return errors.New("recovery code not found or already used")
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/deexth/chirpy/internal/auth"
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	if params.Role != auth.RoleUser && params.Role != auth.RoleAdmin {
+		respondWithError(w, http.StatusBadRequest, "role must be user or admin", nil)
+		return
+	}
+
+	numAffectedRows, err := cfg.db.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userID,
+		Role: params.Role,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	if numAffectedRows == 0 {
+		respondWithError(w, http.StatusNotFound, "user not found", nil)
+		return
+	}
+
+	// Access tokens keep the role they were issued with, so end the user's
+	// sessions to make sure a demotion can't outlive the next refresh.
+	if err := cfg.db.RevokeUserRefreshTokens(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	cfg.recordAudit(r, userID, auditRoleChanged, params.Role)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/deexth/chirpy/internal/auth"
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// APIKey describes a personal API key. The key itself is only returned
+// once, when it is created.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// apiKeyPrefixLength is how much of a key is kept in clear so users can
+// tell their keys apart.
+const apiKeyPrefixLength = 12
+
+func newAPIKey(key database.ApiKey) APIKey {
+	apiKey := APIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if key.ExpiresAt.Valid {
+		apiKey.ExpiresAt = &key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		apiKey.LastUsedAt = &key.LastUsedAt.Time
+	}
+
+	return apiKey
+}
+
+func (cfg *apiConfig) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	userID := requestUserID(r)
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "name is required", nil)
+		return
+	}
+
+	scopes, err := auth.ValidateScopes(params.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if len(scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "at least one scope is required", nil)
+		return
+	}
+
+	expiresAt := sql.NullTime{}
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			respondWithError(w, http.StatusBadRequest, "expires_at must be in the future", nil)
+			return
+		}
+		expiresAt = sql.NullTime{Time: *params.ExpiresAt, Valid: true}
+	}
+
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue creating api key", err)
+		return
+	}
+
+	apiKey, err := cfg.db.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      params.Name,
+		KeyHash:   auth.HashToken(key),
+		Prefix:    key[:apiKeyPrefixLength],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue creating api key", err)
+		return
+	}
+
+	cfg.recordAudit(r, userID, auditAPIKeyCreated, apiKey.ID.String())
+
+	response := newAPIKey(apiKey)
+	response.Key = key
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := cfg.db.ListUserAPIKeys(r.Context(), requestUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving api keys", err)
+		return
+	}
+
+	apiKeys := make([]APIKey, 0, len(keys))
+	for _, key := range keys {
+		apiKeys = append(apiKeys, newAPIKey(key))
+	}
+
+	respondWithJSON(w, http.StatusOK, apiKeys)
+}
+
+func (cfg *apiConfig) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid key id", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	numAffectedRows, err := cfg.db.DeleteUserAPIKey(r.Context(), database.DeleteUserAPIKeyParams{
+		ID:     keyID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	if numAffectedRows == 0 {
+		respondWithError(w, http.StatusNotFound, "api key not found", errors.New("no rows affected"))
+		return
+	}
+
+	cfg.recordAudit(r, userID, auditAPIKeyDeleted, keyID.String())
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,41 +1,61 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"time"
 
-	"github.com/deexth/chirpy/internal/auth"
 	"github.com/deexth/chirpy/internal/database"
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID    `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Body      string       `json:"body"`
+	UserID    uuid.UUID    `json:"user_id"`
+	InReplyTo *uuid.UUID   `json:"in_reply_to"`
+	Author    *ChirpAuthor `json:"author,omitempty"`
+}
+
+func newChirp(chirp database.Chirp, author *ChirpAuthor) Chirp {
+	newChirp := Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		Author:    author,
+	}
+	if chirp.InReplyTo.Valid {
+		newChirp.InReplyTo = &chirp.InReplyTo.UUID
+	}
+
+	return newChirp
 }
 
 func (cfg *apiConfig) handleChirps(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
 	}
 	type returnVals struct {
 		Chirp
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	userID := requestUserID(r)
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "verify your email before posting chirps", nil)
 		return
 	}
 
@@ -53,24 +73,51 @@ func (cfg *apiConfig) handleChirps(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		ID:     uuid.New(),
-		Body:   params.Body,
-		UserID: userID,
+	inReplyTo := uuid.NullUUID{}
+	if params.InReplyTo != nil {
+		parent, err := cfg.db.GetChirp(r.Context(), *params.InReplyTo)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "the chirp being replied to doesn't exist", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "issue creating chirp", err)
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	// The chirp lands in the author's own timeline right away; followers
+	// get it from the fan-out worker. Both are written with the chirp so
+	// it can't exist without being queued.
+	var chirp database.Chirp
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		chirp, err = q.CreateChirp(r.Context(), database.CreateChirpParams{
+			ID:        uuid.New(),
+			Body:      params.Body,
+			UserID:    userID,
+			InReplyTo: inReplyTo,
+		})
+		if err != nil {
+			return err
+		}
+
+		return q.QueueChirpFanout(r.Context(), chirp.ID)
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "issue creating chirp", err)
 		return
 	}
+	cfg.timeline.Publish(chirp.ID)
 
 	respondWithJSON(w, http.StatusCreated, returnVals{
-		Chirp: Chirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		},
+		Chirp: newChirp(chirp, &ChirpAuthor{
+			ID:          user.ID,
+			Handle:      user.Handle,
+			DisplayName: user.DisplayName,
+			AvatarURL:   user.AvatarUrl,
+		}),
 	})
 
 	// badWords := map[string]struct{}{
@@ -87,19 +134,100 @@ func (cfg *apiConfig) handleChirps(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *apiConfig) handleGetChirps(w http.ResponseWriter, r *http.Request) {
-	chirps, err := cfg.db.GetChirps(r.Context(), 5)
+	type response struct {
+		Chirps     []Chirp `json:"chirps"`
+		NextCursor string  `json:"next_cursor,omitempty"`
+	}
+
+	query := r.URL.Query()
+
+	limit, err := parsePageLimit(query.Get("limit"))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "issue retrieving chirps", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	// author_id=me lists the caller's own chirps.
+	authorID := uuid.NullUUID{}
+	switch s := query.Get("author_id"); s {
+	case "":
+	case "me":
+		p, ok := requestPrincipal(r)
+		if !ok {
+			respondUnauthorized(w, r, errors.New("author_id=me needs an access token"))
+			return
+		}
+		authorID = uuid.NullUUID{UUID: p.UserID, Valid: true}
+	default:
+		id, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid author_id", err)
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	afterCreatedAt := sql.NullTime{}
+	afterID := uuid.NullUUID{}
+	if s := query.Get("after"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid cursor", err)
+			return
+		}
+		afterCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		afterID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+
+	// Fetch one extra row so we know whether there is a next page.
+	var chirps []database.Chirp
+	switch query.Get("sort") {
+	case "", "asc":
+		chirps, err = cfg.db.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID:       authorID,
+			AfterCreatedAt: afterCreatedAt,
+			AfterID:        afterID,
+			Limit:          limit + 1,
+		})
+	case "desc":
+		chirps, err = cfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:       authorID,
+			AfterCreatedAt: afterCreatedAt,
+			AfterID:        afterID,
+			Limit:          limit + 1,
+		})
+	default:
+		respondWithError(w, http.StatusBadRequest, "sort must be asc or desc", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving chirps", err)
+		return
+	}
+
+	nextCursor := ""
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	authors, err := cfg.chirpAuthors(r.Context(), chirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving chirps", err)
 		return
 	}
 
 	newChirps := make([]Chirp, 0, len(chirps))
 
 	for _, chirp := range chirps {
-		newChirps = append(newChirps, Chirp(chirp))
+		newChirps = append(newChirps, newChirp(chirp, authors[chirp.UserID]))
 	}
 
-	respondWithJSON(w, http.StatusOK, newChirps)
+	respondWithJSON(w, http.StatusOK, response{
+		Chirps:     newChirps,
+		NextCursor: nextCursor,
+	})
 }
 
 func (cfg *apiConfig) handleGetChirp(w http.ResponseWriter, r *http.Request) {
@@ -115,21 +243,17 @@ func (cfg *apiConfig) handleGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, Chirp(chirp))
-}
-
-func (cfg *apiConfig) handleChirpDeletion(w http.ResponseWriter, r *http.Request) {
-	accessToken, err := auth.GetBearerToken(r.Header)
+	authors, err := cfg.chirpAuthors(r.Context(), []database.Chirp{chirp})
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving chirp", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusForbidden, "unauthorized", err)
-		return
-	}
+	respondWithJSON(w, http.StatusOK, newChirp(chirp, authors[chirp.UserID]))
+}
+
+func (cfg *apiConfig) handleChirpDeletion(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
 
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/deexth/chirpy/internal/mailer"
+)
+
+// handleDeleteUser schedules the caller's account for deletion once
+// they confirm their password. Every session and API key ends right
+// away, but the account is only purged once the grace period is over;
+// logging in before then cancels the deletion. Asking again keeps the
+// original deadline.
+func (cfg *apiConfig) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	if !cfg.confirmCurrentPassword(w, r, user, patchField{value: params.CurrentPassword}) {
+		return
+	}
+
+	var deleteAfter time.Time
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if err := q.RevokeUserRefreshTokens(r.Context(), userID); err != nil {
+			return err
+		}
+		if err := q.DeleteUserAPIKeys(r.Context(), userID); err != nil {
+			return err
+		}
+
+		scheduled, err := q.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+			DeleteAfter: time.Now().Add(cfg.deletionGracePeriod),
+			ID:          userID,
+		})
+		if err != nil {
+			return err
+		}
+		deleteAfter = scheduled.Time
+
+		return nil
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	if !user.DeleteAfter.Valid {
+		cfg.recordAudit(r, userID, auditDeletionRequested, "")
+
+		cfg.sendMail(mailer.Message{
+			To:      user.Email,
+			Subject: "Your Chirpy account will be deleted",
+			Body: fmt.Sprintf("Your Chirpy account and all of its chirps will be deleted permanently after %s.\n\n"+
+				"Changed your mind? Log in before then and the deletion is cancelled.\n",
+				deleteAfter.UTC().Format(time.RFC1123)),
+		})
+	}
+
+	respondWithJSON(w, http.StatusAccepted, struct {
+		DeleteAfter time.Time `json:"delete_after"`
+	}{
+		DeleteAfter: deleteAfter,
+	})
+}
+
+// purgeDeletedUsers hard deletes accounts whose grace period is over,
+// every interval until ctx is done. Chirps and tokens go with them
+// through the foreign keys.
+func (cfg *apiConfig) purgeDeletedUsers(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := cfg.db.PurgeDeletedUsers(ctx)
+		if err != nil {
+			log.Printf("couldn't purge deleted users: %v", err)
+		} else if purged > 0 {
+			log.Printf("purged %d deleted users", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
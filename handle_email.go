@@ -5,23 +5,28 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/deexth/chirpy/internal/auth"
 	"github.com/deexth/chirpy/internal/database"
 	"github.com/google/uuid"
 )
 
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Email     string    `json:"email"`
-	Token     string    `json:"token"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	Role          string    `json:"role"`
+	Handle        string    `json:"handle"`
+	Token         string    `json:"token"`
 }
 
 func (cfg *apiConfig) handleUsers(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
+		Handle   string `json:"handle"`
 	}
 
 	params := parameters{}
@@ -33,37 +38,68 @@ func (cfg *apiConfig) handleUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(params.Password) < 3 {
-		respondWithError(w, http.StatusBadRequest, "password must be atleast 8 characters", nil)
+	if err := validateEmail(params.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
-	hashedPwd, err := auth.HashPassword(params.Password)
+	if err := cfg.passwordPolicy.Check(params.Password); err != nil {
+		respondWithPasswordPolicyError(w, err)
+		return
+	}
+
+	// The handle is optional at sign up; users get a generated one they
+	// can change later.
+	userID := uuid.New()
+	handle := defaultHandle(userID)
+	if params.Handle != "" {
+		var err error
+		handle, err = normalizeHandle(params.Handle)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	hashedPwd, err := cfg.hasher.Hash(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "issue hashing password", err)
 		return
 	}
 
 	user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
-		ID:       uuid.New(),
+		ID:       userID,
 		Email:    params.Email,
 		Password: hashedPwd,
+		Handle:   handle,
 	})
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "email or handle is already taken", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "issue creating user", err)
 		return
 	}
 
+	if err := cfg.sendVerificationEmail(user.ID, user.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue sending verification email", err)
+		return
+	}
+
 	type UserCreated struct {
 		User
 	}
 
 	respondWithJSON(w, http.StatusCreated, UserCreated{
 		User: User{
-			ID:        user.ID,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-			Email:     user.Email,
+			ID:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			Email:       user.Email,
+			IsChirpyRed: user.IsChirpyRed,
+			Role:        user.Role,
+			Handle:      user.Handle,
 		},
 	})
 }
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// exportTTL is how long a finished export can be downloaded before
+	// it is deleted.
+	exportTTL = 7 * 24 * time.Hour
+	// exportStaleAfter is how long a job may run before another worker
+	// assumes its worker died and takes it over.
+	exportStaleAfter   = 15 * time.Minute
+	exportPollInterval = time.Minute
+)
+
+// ExportJob describes a request for a copy of a user's data.
+type ExportJob struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+func newExportJob(job database.GetLatestUserExportJobRow) ExportJob {
+	exportJob := ExportJob{
+		ID:        job.ID,
+		Status:    job.Status,
+		CreatedAt: job.CreatedAt,
+	}
+	if job.CompletedAt.Valid {
+		exportJob.CompletedAt = &job.CompletedAt.Time
+	}
+	if job.ExpiresAt.Valid {
+		exportJob.ExpiresAt = &job.ExpiresAt.Time
+	}
+
+	return exportJob
+}
+
+// AuditEvent is one entry of a user's account history.
+type AuditEvent struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Action    string    `json:"action"`
+	Detail    string    `json:"detail,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+// handleRequestExport queues an export of the caller's data. While one is
+// still being built, that job is returned instead of queueing another.
+func (cfg *apiConfig) handleRequestExport(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	latest, err := cfg.db.GetLatestUserExportJob(r.Context(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+	if err == nil && (latest.Status == "pending" || latest.Status == "running") {
+		respondWithJSON(w, http.StatusAccepted, newExportJob(latest))
+		return
+	}
+
+	job, err := cfg.db.CreateExportJob(r.Context(), database.CreateExportJobParams{
+		ID:     uuid.New(),
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue creating export", err)
+		return
+	}
+
+	cfg.recordAudit(r, userID, auditExportRequested, job.ID.String())
+
+	// Wake the worker rather than have the user wait for its next poll.
+	select {
+	case cfg.exportWake <- struct{}{}:
+	default:
+	}
+
+	respondWithJSON(w, http.StatusAccepted, newExportJob(database.GetLatestUserExportJobRow(job)))
+}
+
+// handleGetExport downloads the caller's latest export once it is ready,
+// and reports its status until then.
+func (cfg *apiConfig) handleGetExport(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	job, err := cfg.db.GetLatestUserExportJob(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "no export has been requested", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	switch job.Status {
+	case "pending", "running":
+		respondWithJSON(w, http.StatusAccepted, newExportJob(job))
+		return
+	case "failed":
+		respondWithJSON(w, http.StatusOK, newExportJob(job))
+		return
+	}
+
+	archive, err := cfg.db.GetUserExportArchive(r.Context(), database.GetUserExportArchiveParams{
+		ID:     job.ID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "no export has been requested", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, job.CreatedAt.UTC().Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// runExportWorker builds queued exports until ctx is done. Jobs are
+// claimed with SKIP LOCKED, so any number of instances can run it.
+func (cfg *apiConfig) runExportWorker(ctx context.Context) {
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := cfg.db.DeleteExpiredExportJobs(ctx); err != nil {
+			log.Printf("couldn't delete expired exports: %v", err)
+		}
+
+		for cfg.runExportJob(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-cfg.exportWake:
+		}
+	}
+}
+
+// runExportJob claims and builds one export. It reports whether there
+// was a job to run.
+func (cfg *apiConfig) runExportJob(ctx context.Context) bool {
+	job, err := cfg.db.ClaimExportJob(ctx, int32(exportStaleAfter.Seconds()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Printf("couldn't claim export job: %v", err)
+		return false
+	}
+
+	archive, err := cfg.buildExport(ctx, job.UserID)
+	if err != nil {
+		log.Printf("couldn't build export %s: %v", job.ID, err)
+		err = cfg.db.FailExportJob(ctx, database.FailExportJobParams{
+			ID:    job.ID,
+			Error: sql.NullString{String: err.Error(), Valid: true},
+		})
+		if err != nil {
+			log.Printf("couldn't mark export %s failed: %v", job.ID, err)
+		}
+		return true
+	}
+
+	err = cfg.db.CompleteExportJob(ctx, database.CompleteExportJobParams{
+		ID:        job.ID,
+		Archive:   archive,
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(exportTTL), Valid: true},
+	})
+	if err != nil {
+		log.Printf("couldn't store export %s: %v", job.ID, err)
+	}
+
+	return true
+}
+
+// buildExport zips everything held on a user as one JSON file per kind
+// of data.
+func (cfg *apiConfig) buildExport(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := struct {
+		User
+		DisplayName      string     `json:"display_name"`
+		Bio              string     `json:"bio"`
+		AvatarURL        string     `json:"avatar_url"`
+		TwoFactorEnabled bool       `json:"two_factor_enabled"`
+		DeleteAfter      *time.Time `json:"delete_after,omitempty"`
+	}{
+		User: User{
+			ID:            user.ID,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
+			Email:         user.Email,
+			IsChirpyRed:   user.IsChirpyRed,
+			EmailVerified: user.EmailVerifiedAt.Valid,
+			PendingEmail:  user.PendingEmail.String,
+			Role:          user.Role,
+			Handle:        user.Handle,
+		},
+		DisplayName:      user.DisplayName,
+		Bio:              user.Bio,
+		AvatarURL:        user.AvatarUrl,
+		TwoFactorEnabled: user.TotpEnabledAt.Valid,
+	}
+	if user.DeleteAfter.Valid {
+		profile.DeleteAfter = &user.DeleteAfter.Time
+	}
+
+	dbChirps, err := cfg.db.ListUserChirps(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	chirps := make([]Chirp, 0, len(dbChirps))
+	for _, chirp := range dbChirps {
+		chirps = append(chirps, newChirp(chirp, nil))
+	}
+
+	dbSessions, err := cfg.db.ListUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, 0, len(dbSessions))
+	for _, session := range dbSessions {
+		sessions = append(sessions, newSession(session))
+	}
+
+	dbEvents, err := cfg.db.ListUserAuditEvents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]AuditEvent, 0, len(dbEvents))
+	for _, event := range dbEvents {
+		events = append(events, AuditEvent{
+			ID:        event.ID,
+			CreatedAt: event.CreatedAt,
+			Action:    event.Action,
+			Detail:    event.Detail,
+			IP:        event.Ip,
+			UserAgent: event.UserAgent,
+		})
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, file := range []struct {
+		name string
+		data any
+	}{
+		{"profile.json", profile},
+		{"chirps.json", chirps},
+		{"sessions.json", sessions},
+		{"audit_events.json", events},
+	} {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, fmt.Errorf("couldn't write %s: %v", file.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
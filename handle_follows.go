@@ -0,0 +1,238 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// FollowEntry is a user in a follower or following list.
+type FollowEntry struct {
+	ChirpAuthor
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func (cfg *apiConfig) handleFollow(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	followee, err := cfg.lookupProfile(r.Context(), r.PathValue("userRef"))
+	if err != nil {
+		respondWithLookupError(w, err)
+		return
+	}
+
+	if followee.ID == userID {
+		respondWithError(w, http.StatusBadRequest, "you can't follow yourself", nil)
+		return
+	}
+
+	// Following twice is not an error; the original follow is kept.
+	_, err = cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followee.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	// The backfill skips chirps already in the timeline, so it runs on
+	// every follow; a retry then repairs one that failed after the
+	// follow was stored.
+	if err := cfg.timeline.Follow(r.Context(), userID, followee.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleUnfollow(w http.ResponseWriter, r *http.Request) {
+	followee, err := cfg.lookupProfile(r.Context(), r.PathValue("userRef"))
+	if err != nil {
+		respondWithLookupError(w, err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	_, err = cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followee.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	// Cleaned up even when there was no follow, in case an earlier
+	// unfollow failed halfway.
+	if err := cfg.timeline.Unfollow(r.Context(), userID, followee.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleListFollowers(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollowList(w, r, func(params followListParams) ([]FollowEntry, error) {
+		rows, err := cfg.db.ListFollowers(r.Context(), database.ListFollowersParams(params))
+		entries := make([]FollowEntry, 0, len(rows))
+		for _, row := range rows {
+			entries = append(entries, newFollowEntry(database.ListFollowingRow(row)))
+		}
+		return entries, err
+	})
+}
+
+func (cfg *apiConfig) handleListFollowing(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollowList(w, r, func(params followListParams) ([]FollowEntry, error) {
+		rows, err := cfg.db.ListFollowing(r.Context(), database.ListFollowingParams(params))
+		entries := make([]FollowEntry, 0, len(rows))
+		for _, row := range rows {
+			entries = append(entries, newFollowEntry(row))
+		}
+		return entries, err
+	})
+}
+
+// followListParams has the same shape as the params of both list
+// queries, so either can be built from it.
+type followListParams struct {
+	UserID         uuid.UUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func newFollowEntry(row database.ListFollowingRow) FollowEntry {
+	return FollowEntry{
+		ChirpAuthor: ChirpAuthor{
+			ID:          row.ID,
+			Handle:      row.Handle,
+			DisplayName: row.DisplayName,
+			AvatarURL:   row.AvatarUrl,
+		},
+		FollowedAt: row.CreatedAt,
+	}
+}
+
+// respondWithFollowList pages through a follow list, newest first.
+func (cfg *apiConfig) respondWithFollowList(w http.ResponseWriter, r *http.Request, list func(followListParams) ([]FollowEntry, error)) {
+	type response struct {
+		Users      []FollowEntry `json:"users"`
+		NextCursor string        `json:"next_cursor,omitempty"`
+	}
+
+	profile, err := cfg.lookupProfile(r.Context(), r.PathValue("userRef"))
+	if err != nil {
+		respondWithLookupError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	params := followListParams{
+		UserID: profile.ID,
+		Limit:  limit + 1,
+	}
+	if s := query.Get("after"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid cursor", err)
+			return
+		}
+		params.AfterCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+
+	entries, err := list(params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving users", err)
+		return
+	}
+
+	nextCursor := ""
+	if len(entries) > int(limit) {
+		entries = entries[:limit]
+		last := entries[len(entries)-1]
+		nextCursor = encodeCursor(last.FollowedAt, last.ID)
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Users:      entries,
+		NextCursor: nextCursor,
+	})
+}
+
+// handleTimeline lists chirps by the users the caller follows and the
+// caller's own, newest first. It reads the timeline materialized by
+// cfg.timeline, so a new follow only brings in timeline.BackfillLimit
+// chirps per author.
+func (cfg *apiConfig) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Chirps     []Chirp `json:"chirps"`
+		NextCursor string  `json:"next_cursor,omitempty"`
+	}
+
+	query := r.URL.Query()
+
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	params := database.ListTimelineParams{
+		UserID: requestUserID(r),
+		Limit:  limit + 1,
+	}
+	if s := query.Get("after"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid cursor", err)
+			return
+		}
+		params.AfterCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+
+	chirps, err := cfg.db.ListTimeline(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving timeline", err)
+		return
+	}
+
+	nextCursor := ""
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	authors, err := cfg.chirpAuthors(r.Context(), chirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving timeline", err)
+		return
+	}
+
+	newChirps := make([]Chirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		newChirps = append(newChirps, newChirp(chirp, authors[chirp.UserID]))
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Chirps:     newChirps,
+		NextCursor: nextCursor,
+	})
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"net/http"
+)
+
+func (cfg *apiConfig) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.keyring.JWKS())
+}
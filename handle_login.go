@@ -2,23 +2,23 @@ package main
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/deexth/chirpy/internal/auth"
 	"github.com/deexth/chirpy/internal/database"
+	"github.com/deexth/chirpy/internal/throttle"
+	"github.com/google/uuid"
 )
 
+const mfaChallengeTTL = time.Minute * 5
+
 func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
 	}
-	type response struct {
-		User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
 
 	params := parameters{}
 	decoder := json.NewDecoder(r.Body)
@@ -29,6 +29,19 @@ func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The attempt is counted before the password is checked; a success
+	// takes it back below.
+	throttleKeys := []throttle.Key{throttle.EmailKey(params.Email), throttle.IPKey(clientIP(r))}
+	retryAfter, err := cfg.throttle.Reserve(r.Context(), throttleKeys...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+	if retryAfter > 0 {
+		respondWithRetryAfter(w, retryAfter)
+		return
+	}
+
 	user, err := cfg.db.GetUser(r.Context(), params.Email)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "incorrect email or password", err)
@@ -37,40 +50,122 @@ func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	ok, err := auth.CheckPasswordHash(params.Password, user.Password)
 	if err != nil || !ok {
+		cfg.recordAudit(r, user.ID, auditLoginFailed, "")
 		respondWithError(w, http.StatusUnauthorized, "incorrect email or password", err)
 		return
 	}
 
-	expiresIn := time.Hour
-	accessToken, err := auth.MakeJWT(user.ID, cfg.tokenSecret, expiresIn)
+	cfg.upgradePasswordHash(r, user, params.Password)
+
+	// Only the account counter is cleared; the address keeps its count so
+	// one valid login can't reset a password spraying run.
+	if err := cfg.throttle.Reset(r.Context(), throttle.EmailKey(params.Email)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+	if err := cfg.throttle.Release(r.Context(), throttle.IPKey(clientIP(r))); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	cfg.completeLogin(w, r, user)
+}
+
+// completeLogin finishes a login whose first factor succeeded: accounts
+// with two-factor authentication get an MFA challenge, everyone else a
+// new session.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	if user.TotpEnabledAt.Valid {
+		mfaToken, err := cfg.keyring.MakeMFAToken(user.ID, mfaChallengeTTL)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "issue creating token", err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, struct {
+			MFARequired bool   `json:"mfa_required"`
+			MFAToken    string `json:"mfa_token"`
+		}{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		})
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
+
+// upgradePasswordHash rehashes the password with the current parameters
+// when the stored hash was made with weaker ones. It never fails the
+// login; the next one will simply try again.
+func (cfg *apiConfig) upgradePasswordHash(r *http.Request, user database.User, password string) {
+	needsRehash, err := cfg.hasher.NeedsRehash(user.Password)
+	if err != nil || !needsRehash {
+		return
+	}
+
+	hashedPwd, err := cfg.hasher.Hash(password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "issue creating token", err)
+		log.Printf("couldn't rehash password: %v", err)
 		return
 	}
 
-	token, err := auth.MakeRefreshToken()
+	// Matching on the old hash keeps a concurrent password change from
+	// being overwritten.
+	_, err = cfg.db.RehashUserPassword(r.Context(), database.RehashUserPasswordParams{
+		NewPassword: hashedPwd,
+		ID:          user.ID,
+		OldPassword: user.Password,
+	})
+	if err != nil {
+		log.Printf("couldn't store rehashed password: %v", err)
+	}
+}
+
+// respondWithSession starts a new session for a fully authenticated user
+// and responds with its access and refresh tokens.
+func (cfg *apiConfig) respondWithSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	type response struct {
+		User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// Logging in during the grace period restores a deleted account.
+	if user.DeleteAfter.Valid {
+		if _, err := cfg.db.CancelUserDeletion(r.Context(), user.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+		cfg.recordAudit(r, user.ID, auditDeletionCancelled, "")
+	}
+
+	expiresIn := time.Hour
+	accessToken, err := cfg.keyring.MakeJWT(user.ID, user.Role, expiresIn)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "issue creating token", err)
 		return
 	}
 
-	expiresIn = time.Hour * 24 * 60
-	refreshToken, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     token,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(expiresIn),
-	})
+	refreshToken, err := cfg.createRefreshToken(r, user.ID, uuid.New(), uuid.NullUUID{}, nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "issue creating refresh token", err)
 		return
 	}
 
+	cfg.recordAudit(r, user.ID, auditLogin, "")
+
 	respondWithJSON(w, http.StatusOK, response{
 		User: User{
-			ID:        user.ID,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:            user.ID,
+			Email:         user.Email,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
+			IsChirpyRed:   user.IsChirpyRed,
+			EmailVerified: user.EmailVerifiedAt.Valid,
+			PendingEmail:  user.PendingEmail.String,
+			Role:          user.Role,
+			Handle:        user.Handle,
 		},
 		Token:        accessToken,
 		RefreshToken: refreshToken,
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deexth/chirpy/internal/auth"
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	authorizationCodeTTL = time.Minute * 10
+	oauthAccessTokenTTL  = time.Hour
+)
+
+// OAuthClient is a third-party application registered by a user. The
+// secret of a confidential client is only returned once, when the
+// client is created.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+func newOAuthClient(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+func (cfg *apiConfig) handleCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "name is required", nil)
+		return
+	}
+
+	if len(params.RedirectURIs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "at least one redirect uri is required", nil)
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if err := auth.ValidateRedirectURI(uri); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	scopes, err := auth.ValidateScopes(params.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if len(scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "at least one scope is required", nil)
+		return
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "issue creating client secret", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		ID:           uuid.New(),
+		OwnerID:      requestUserID(r),
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       scopes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue creating client", err)
+		return
+	}
+
+	response := newOAuthClient(client)
+	response.Secret = secret
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) handleListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := cfg.db.ListUserOAuthClients(r.Context(), requestUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving clients", err)
+		return
+	}
+
+	response := make([]OAuthClient, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, newOAuthClient(client))
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handleDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid client id", err)
+		return
+	}
+
+	numAffectedRows, err := cfg.db.DeleteUserOAuthClient(r.Context(), database.DeleteUserOAuthClientParams{
+		ID:      clientID,
+		OwnerID: requestUserID(r),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	if numAffectedRows == 0 {
+		respondWithError(w, http.StatusNotFound, "client not found", errors.New("no rows affected"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// oauthError is an error response as defined by RFC 6749 section 5.2.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, oerr oauthError, err error) {
+	if err != nil {
+		log.Println(err)
+	}
+	respondWithJSON(w, code, oerr)
+}
+
+// authorizationRequest is a validated request from a client to act on
+// the user's behalf.
+type authorizationRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	scopes        []string
+	state         string
+	codeChallenge string
+}
+
+// parseAuthorizationRequest validates the query of an authorization
+// request. The consent screen calls GET with it to describe the request
+// and POST with the same query to answer it.
+func (cfg *apiConfig) parseAuthorizationRequest(r *http.Request) (authorizationRequest, error) {
+	query := r.URL.Query()
+
+	if query.Get("response_type") != "code" {
+		return authorizationRequest{}, oauthError{"unsupported_response_type", "response_type must be code"}
+	}
+
+	clientID, err := uuid.Parse(query.Get("client_id"))
+	if err != nil {
+		return authorizationRequest{}, oauthError{"invalid_request", "invalid client_id"}
+	}
+
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return authorizationRequest{}, oauthError{"invalid_request", "unknown client_id"}
+	}
+	if err != nil {
+		return authorizationRequest{}, err
+	}
+
+	redirectURI := query.Get("redirect_uri")
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return authorizationRequest{}, oauthError{"invalid_request", "redirect_uri is not registered for this client"}
+	}
+
+	scopes, err := auth.ParseScopes(query.Get("scope"))
+	if err != nil {
+		return authorizationRequest{}, oauthError{"invalid_scope", err.Error()}
+	}
+	if len(scopes) == 0 {
+		return authorizationRequest{}, oauthError{"invalid_scope", "scope is required"}
+	}
+	for _, scope := range scopes {
+		if !auth.HasScope(client.Scopes, scope) {
+			return authorizationRequest{}, oauthError{"invalid_scope", "client may not request " + scope}
+		}
+	}
+
+	if query.Get("code_challenge_method") != "S256" {
+		return authorizationRequest{}, oauthError{"invalid_request", "code_challenge_method must be S256"}
+	}
+	codeChallenge := query.Get("code_challenge")
+	if err := auth.ValidatePKCEChallenge(codeChallenge); err != nil {
+		return authorizationRequest{}, oauthError{"invalid_request", err.Error()}
+	}
+
+	return authorizationRequest{
+		client:        client,
+		redirectURI:   redirectURI,
+		scopes:        scopes,
+		state:         query.Get("state"),
+		codeChallenge: codeChallenge,
+	}, nil
+}
+
+// respondWithAuthorizationError reports a bad authorization request. The
+// user agent is never redirected for these since the redirect URI may
+// not belong to the client.
+func respondWithAuthorizationError(w http.ResponseWriter, err error) {
+	var oerr oauthError
+	if errors.As(err, &oerr) {
+		respondWithOAuthError(w, http.StatusBadRequest, oerr, nil)
+		return
+	}
+
+	respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+}
+
+func (cfg *apiConfig) handleOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, err := cfg.parseAuthorizationRequest(r)
+	if err != nil {
+		respondWithAuthorizationError(w, err)
+		return
+	}
+
+	consented, err := cfg.db.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{
+		UserID:   requestUserID(r),
+		ClientID: req.client.ID,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	consentRequired := false
+	for _, scope := range req.scopes {
+		if !auth.HasScope(consented, scope) {
+			consentRequired = true
+		}
+	}
+
+	type client struct {
+		ID   uuid.UUID `json:"client_id"`
+		Name string    `json:"name"`
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		Client          client   `json:"client"`
+		Scopes          []string `json:"scopes"`
+		RedirectURI     string   `json:"redirect_uri"`
+		ConsentRequired bool     `json:"consent_required"`
+	}{
+		Client:          client{ID: req.client.ID, Name: req.client.Name},
+		Scopes:          req.scopes,
+		RedirectURI:     req.redirectURI,
+		ConsentRequired: consentRequired,
+	})
+}
+
+func (cfg *apiConfig) handleOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Approve bool `json:"approve"`
+	}
+
+	req, err := cfg.parseAuthorizationRequest(r)
+	if err != nil {
+		respondWithAuthorizationError(w, err)
+		return
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	if !params.Approve {
+		respondWithJSON(w, http.StatusOK, response{
+			RedirectTo: authorizationRedirect(req, url.Values{"error": {"access_denied"}}),
+		})
+		return
+	}
+
+	userID := requestUserID(r)
+
+	consented, err := cfg.db.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{
+		UserID:   userID,
+		ClientID: req.client.ID,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	consented = append(consented, req.scopes...)
+	slices.Sort(consented)
+	err = cfg.db.UpsertOAuthConsent(r.Context(), database.UpsertOAuthConsentParams{
+		UserID:   userID,
+		ClientID: req.client.ID,
+		Scopes:   slices.Compact(consented),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	cfg.recordAudit(r, userID, auditOAuthConsent, req.client.ID.String())
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue creating authorization code", err)
+		return
+	}
+
+	err = cfg.db.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.client.ID,
+		UserID:        userID,
+		RedirectUri:   req.redirectURI,
+		Scopes:        req.scopes,
+		CodeChallenge: req.codeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue creating authorization code", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		RedirectTo: authorizationRedirect(req, url.Values{"code": {code}}),
+	})
+}
+
+// authorizationRedirect adds params and the client's state to the
+// redirect URI, keeping any query it was registered with.
+func authorizationRedirect(req authorizationRequest, params url.Values) string {
+	u, _ := url.Parse(req.redirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.state != "" {
+		query.Set("state", req.state)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func (cfg *apiConfig) handleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthError{"invalid_request", "invalid form body"}, err)
+		return
+	}
+
+	// Tokens must never be cached (RFC 6749 section 5.1).
+	w.Header().Set("Cache-Control", "no-store")
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if errors.Is(err, errLookupFailed) {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+	if err != nil {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		respondWithOAuthError(w, http.StatusUnauthorized, oauthError{"invalid_client", "client authentication failed"}, err)
+		return
+	}
+
+	var userID uuid.UUID
+	var scopes []string
+	var refreshToken string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, err := cfg.db.UseOAuthAuthorizationCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthError{"invalid_grant", "invalid or expired code"}, nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+
+		if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthError{"invalid_grant", "code was issued to another client or redirect_uri"}, nil)
+			return
+		}
+		if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthError{"invalid_grant", "code_verifier does not match"}, nil)
+			return
+		}
+
+		userID = code.UserID
+		scopes = code.Scopes
+		refreshToken, err = cfg.createRefreshToken(r, code.UserID, uuid.New(), uuid.NullUUID{UUID: client.ID, Valid: true}, code.Scopes)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "issue creating refresh token", err)
+			return
+		}
+
+	case "refresh_token":
+		requested, err := auth.ParseScopes(r.PostForm.Get("scope"))
+		if err != nil {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthError{"invalid_scope", err.Error()}, nil)
+			return
+		}
+
+		newToken, old, err := cfg.rotateRefreshToken(r, r.PostForm.Get("refresh_token"), uuid.NullUUID{UUID: client.ID, Valid: true})
+		if err != nil {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthError{"invalid_grant", "invalid refresh token"}, err)
+			return
+		}
+
+		// A client may ask for fewer scopes than were granted, never
+		// more. The refresh token keeps the full grant either way.
+		userID = old.UserID
+		scopes = old.Scopes
+		if len(requested) > 0 {
+			for _, scope := range requested {
+				if !auth.HasScope(old.Scopes, scope) {
+					respondWithOAuthError(w, http.StatusBadRequest, oauthError{"invalid_scope", "scope exceeds the original grant"}, nil)
+					return
+				}
+			}
+			scopes = requested
+		}
+		refreshToken = newToken
+
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, oauthError{"unsupported_grant_type", "grant_type must be authorization_code or refresh_token"}, nil)
+		return
+	}
+
+	accessToken, err := cfg.keyring.MakeOAuthAccessToken(userID, client.ID, scopes, oauthAccessTokenTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue creating token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+// authenticateOAuthClient identifies the client calling the token
+// endpoint, either through HTTP Basic or client_id and client_secret
+// form fields. Public clients only send client_id.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	rawID, secret, ok := r.BasicAuth()
+	if ok {
+		// RFC 6749 section 2.3.1 form-encodes both parts.
+		var err error
+		if rawID, err = url.QueryUnescape(rawID); err != nil {
+			return database.OauthClient{}, err
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return database.OauthClient{}, err
+		}
+	} else {
+		rawID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(rawID)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+	if err != nil {
+		return database.OauthClient{}, fmt.Errorf("%w: %v", errLookupFailed, err)
+	}
+
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return database.OauthClient{}, errors.New("public client sent a secret")
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errors.New("wrong client secret")
+	}
+
+	return client, nil
+}
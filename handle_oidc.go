@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deexth/chirpy/internal/auth"
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/deexth/chirpy/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const (
+	oidcStateCookie = "chirpy_oidc"
+	oidcStateTTL    = time.Minute * 10
+)
+
+var (
+	errOIDCEmailUnverified = errors.New("identity provider did not supply a verified email")
+	errOIDCAccountConflict = errors.New("an account with this email exists but its email is not verified")
+)
+
+func (cfg *apiConfig) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var state auth.OIDCState
+	for _, v := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		random, err := auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+		*v = random
+	}
+
+	redirectURL, err := cfg.oidc.AuthCodeURL(r.Context(), state.State, state.Nonce, auth.PKCEChallenge(state.Verifier))
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "identity provider unavailable", err)
+		return
+	}
+
+	stateToken, err := cfg.keyring.MakeOIDCStateToken(state, oidcStateTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	http.SetCookie(w, cfg.oidcStateCookie(stateToken, int(oidcStateTTL.Seconds())))
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+func (cfg *apiConfig) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "missing sign in state", err)
+		return
+	}
+
+	// The state is single use whatever the outcome.
+	http.SetCookie(w, cfg.oidcStateCookie("", -1))
+
+	state, err := cfg.keyring.ValidateOIDCStateToken(cookie.Value)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid sign in state", err)
+		return
+	}
+
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		respondWithError(w, http.StatusBadRequest, "invalid sign in state", nil)
+		return
+	}
+
+	if e := query.Get("error"); e != "" {
+		respondWithError(w, http.StatusUnauthorized, "sign in was not completed", fmt.Errorf("identity provider returned %s", e))
+		return
+	}
+
+	identity, err := cfg.oidc.Exchange(r.Context(), query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "sign in failed", err)
+		return
+	}
+
+	user, err := cfg.userForIdentity(r.Context(), identity)
+	if errors.Is(err, errOIDCEmailUnverified) {
+		respondWithError(w, http.StatusForbidden, err.Error(), err)
+		return
+	}
+	if errors.Is(err, errOIDCAccountConflict) {
+		respondWithError(w, http.StatusConflict, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	cfg.completeLogin(w, r, user)
+}
+
+// userForIdentity finds the account linked to an external identity. On
+// first sign in it links an existing account with the same email, but
+// only when both sides have verified that email; otherwise whoever
+// controls the provider account could take over the chirpy one. Without
+// an existing account, a new one is created.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, identity oidc.Identity) (database.User, error) {
+	link, err := cfg.db.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		return cfg.db.GetUserByID(ctx, link.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return database.User{}, errOIDCEmailUnverified
+	}
+
+	user, err := cfg.db.GetUser(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !user.EmailVerifiedAt.Valid {
+			return database.User{}, errOIDCAccountConflict
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = cfg.createOIDCUser(ctx, identity.Email)
+		if err != nil {
+			return database.User{}, err
+		}
+	default:
+		return database.User{}, err
+	}
+
+	err = cfg.db.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		UserID:  user.ID,
+		Email:   identity.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return user, nil
+}
+
+// createOIDCUser creates an account for a user who signed in through the
+// identity provider. It gets a random password nobody knows; a password
+// reset can set a real one later.
+func (cfg *apiConfig) createOIDCUser(ctx context.Context, email string) (database.User, error) {
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+
+	hashedPwd, err := cfg.hasher.Hash(password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	userID := uuid.New()
+	created, err := cfg.db.CreateUser(ctx, database.CreateUserParams{
+		ID:       userID,
+		Email:    email,
+		Password: hashedPwd,
+		Handle:   defaultHandle(userID),
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	_, err = cfg.db.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+		ID:    created.ID,
+		Email: email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return cfg.db.GetUserByID(ctx, created.ID)
+}
+
+func (cfg *apiConfig) oidcStateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.baseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/deexth/chirpy/internal/auth"
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/deexth/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+func (cfg *apiConfig) handlePasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	// Always answer the same way so the endpoint can't be used to find
+	// out which emails have accounts.
+	user, err := cfg.db.GetUser(r.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	err = cfg.db.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	link := cfg.baseURL + "/app/reset-password?token=" + url.QueryEscape(token)
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Use this link within the next hour to choose a new one:\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.\n", link),
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) handlePasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	if err := cfg.passwordPolicy.Check(params.Password); err != nil {
+		respondWithPasswordPolicyError(w, err)
+		return
+	}
+
+	hashedPwd, err := cfg.hasher.Hash(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue hashing password", err)
+		return
+	}
+
+	// The link is only used up if the new password is stored, so a
+	// failure leaves it valid for another try.
+	var userID uuid.UUID
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		userID, err = q.UsePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+		if err != nil {
+			return err
+		}
+
+		err = q.SetUserPassword(r.Context(), database.SetUserPasswordParams{
+			ID:       userID,
+			Password: hashedPwd,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Whoever knew the old password shouldn't keep a session or
+		// another pending reset link.
+		return endPasswordSessions(r.Context(), q, userID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "invalid or expired token", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	cfg.recordAudit(r, userID, auditPasswordReset, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
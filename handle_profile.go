@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 2048
+)
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// Profile is the public view of a user. It never includes the email
+// address or anything else only the user should see.
+type Profile struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newProfile(profile database.GetUserProfileRow) Profile {
+	return Profile{
+		ID:          profile.ID,
+		Handle:      profile.Handle,
+		DisplayName: profile.DisplayName,
+		Bio:         profile.Bio,
+		AvatarURL:   profile.AvatarUrl,
+		IsChirpyRed: profile.IsChirpyRed,
+		CreatedAt:   profile.CreatedAt,
+	}
+}
+
+// ChirpAuthor is the compact profile embedded in chirps.
+type ChirpAuthor struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+}
+
+// defaultHandle is the handle a user gets until they pick one. It is
+// derived from the user id so it is unique without a lookup.
+func defaultHandle(id uuid.UUID) string {
+	return "user_" + strings.ReplaceAll(id.String(), "-", "")[:12]
+}
+
+// normalizeHandle lowercases a handle, dropping a leading @, and checks
+// that it is 3 to 30 letters, digits or underscores.
+func normalizeHandle(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+	if !handlePattern.MatchString(handle) {
+		return "", errors.New("handle must be 3 to 30 letters, digits or underscores")
+	}
+
+	return handle, nil
+}
+
+func validateAvatarURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if len(raw) > maxAvatarURLLength {
+		return errors.New("avatar_url is too long")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("avatar_url must be an https URL")
+	}
+
+	return nil
+}
+
+var errInvalidUserRef = errors.New("invalid user id")
+
+// lookupProfile finds a user by id or, with a leading @, by handle.
+func (cfg *apiConfig) lookupProfile(ctx context.Context, ref string) (database.GetUserProfileRow, error) {
+	if strings.HasPrefix(ref, "@") {
+		handle, err := normalizeHandle(ref)
+		if err != nil {
+			// No user can have an invalid handle.
+			return database.GetUserProfileRow{}, sql.ErrNoRows
+		}
+		profile, err := cfg.db.GetUserProfileByHandle(ctx, handle)
+		return database.GetUserProfileRow(profile), err
+	}
+
+	userID, err := uuid.Parse(ref)
+	if err != nil {
+		return database.GetUserProfileRow{}, errInvalidUserRef
+	}
+
+	return cfg.db.GetUserProfile(ctx, userID)
+}
+
+// respondWithLookupError responds to a failed lookupProfile.
+func respondWithLookupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidUserRef):
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, sql.ErrNoRows):
+		respondWithError(w, http.StatusNotFound, "user not found", err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+	}
+}
+
+func (cfg *apiConfig) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := cfg.lookupProfile(r.Context(), r.PathValue("userRef"))
+	if err != nil {
+		respondWithLookupError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newProfile(profile))
+}
+
+func (cfg *apiConfig) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		AvatarURL   string `json:"avatar_url"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	handle, err := normalizeHandle(params.Handle)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	displayName := strings.TrimSpace(params.DisplayName)
+	if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("display_name must be at most %d characters", maxDisplayNameLength), nil)
+		return
+	}
+
+	if utf8.RuneCountInString(params.Bio) > maxBioLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("bio must be at most %d characters", maxBioLength), nil)
+		return
+	}
+
+	if err := validateAvatarURL(params.AvatarURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	profile, err := cfg.db.UpdateUserProfile(r.Context(), database.UpdateUserProfileParams{
+		ID:          requestUserID(r),
+		Handle:      handle,
+		DisplayName: displayName,
+		Bio:         params.Bio,
+		AvatarUrl:   params.AvatarURL,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "handle is already taken", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newProfile(database.GetUserProfileRow(profile)))
+}
+
+// chirpAuthors looks up the authors of chirps in one query.
+func (cfg *apiConfig) chirpAuthors(ctx context.Context, chirps []database.Chirp) (map[uuid.UUID]*ChirpAuthor, error) {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.UserID)
+	}
+
+	rows, err := cfg.db.ListChirpAuthors(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make(map[uuid.UUID]*ChirpAuthor, len(rows))
+	for _, row := range rows {
+		authors[row.ID] = &ChirpAuthor{
+			ID:          row.ID,
+			Handle:      row.Handle,
+			DisplayName: row.DisplayName,
+			AvatarURL:   row.AvatarUrl,
+		}
+	}
+
+	return authors, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Session is a login on one device. Rotating its refresh token keeps the
+// same session ID, so it stays stable for the lifetime of the login.
+// Grants to OAuth clients are listed as sessions too, naming the client,
+// so revoking one cuts the client off.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ClientID   *uuid.UUID `json:"client_id,omitempty"`
+}
+
+func newSession(session database.ListUserSessionsRow) Session {
+	newSession := Session{
+		ID:         session.FamilyID,
+		UserAgent:  session.UserAgent,
+		IP:         session.Ip,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+	}
+	if session.ClientID.Valid {
+		newSession.ClientID = &session.ClientID.UUID
+	}
+
+	return newSession
+}
+
+func (cfg *apiConfig) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	sessions, err := cfg.db.ListUserSessions(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving sessions", err)
+		return
+	}
+
+	newSessions := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		newSessions = append(newSessions, newSession(session))
+	}
+
+	respondWithJSON(w, http.StatusOK, newSessions)
+}
+
+func (cfg *apiConfig) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid session id", err)
+		return
+	}
+
+	numAffectedRows, err := cfg.db.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	if numAffectedRows == 0 {
+		respondWithError(w, http.StatusNotFound, "session not found", errors.New("no rows affected"))
+		return
+	}
+
+	cfg.recordAudit(r, userID, auditSessionRevoked, sessionID.String())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	if err := cfg.db.RevokeUserRefreshTokens(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	cfg.recordAudit(r, userID, auditLogoutAll, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
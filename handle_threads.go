@@ -0,0 +1,192 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxThreadDepth bounds how far a thread is followed up and down
+	// from the requested chirp.
+	maxThreadDepth = 50
+	// maxThreadReplies bounds how many replies a thread returns. The
+	// walk goes level by level and stops at the bound, so the replies
+	// nearest the chirp are kept and every kept reply's parent is too.
+	maxThreadReplies = 500
+)
+
+// ThreadNode is a chirp with the replies to it.
+type ThreadNode struct {
+	Chirp
+	Replies []*ThreadNode `json:"replies"`
+}
+
+// getParentChirp loads the chirp named in the path for the reply and
+// thread endpoints, responding itself when it can't.
+func (cfg *apiConfig) getParentChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id", err)
+		return database.Chirp{}, false
+	}
+
+	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "chirp not found", err)
+		return database.Chirp{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving chirp", err)
+		return database.Chirp{}, false
+	}
+
+	return chirp, true
+}
+
+// handleGetReplies lists the direct replies to a chirp, oldest first.
+func (cfg *apiConfig) handleGetReplies(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Chirps     []Chirp `json:"chirps"`
+		NextCursor string  `json:"next_cursor,omitempty"`
+	}
+
+	parent, ok := cfg.getParentChirp(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	params := database.ListChirpRepliesParams{
+		ChirpID: parent.ID,
+		Limit:   limit + 1,
+	}
+	if s := query.Get("after"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid cursor", err)
+			return
+		}
+		params.AfterCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+
+	replies, err := cfg.db.ListChirpReplies(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving replies", err)
+		return
+	}
+
+	nextCursor := ""
+	if len(replies) > int(limit) {
+		replies = replies[:limit]
+		last := replies[len(replies)-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	authors, err := cfg.chirpAuthors(r.Context(), replies)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving replies", err)
+		return
+	}
+
+	newChirps := make([]Chirp, 0, len(replies))
+	for _, reply := range replies {
+		newChirps = append(newChirps, newChirp(reply, authors[reply.UserID]))
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Chirps:     newChirps,
+		NextCursor: nextCursor,
+	})
+}
+
+// handleGetThread returns the conversation around a chirp: the chain of
+// chirps it replies to, root first, and the tree of replies below it.
+func (cfg *apiConfig) handleGetThread(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Ancestors []Chirp     `json:"ancestors"`
+		Chirp     *ThreadNode `json:"chirp"`
+		Truncated bool        `json:"truncated"`
+	}
+
+	chirp, ok := cfg.getParentChirp(w, r)
+	if !ok {
+		return
+	}
+
+	ancestorRows, err := cfg.db.ListChirpAncestors(r.Context(), database.ListChirpAncestorsParams{
+		ChirpID:  chirp.ID,
+		MaxDepth: maxThreadDepth,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving thread", err)
+		return
+	}
+
+	descendantRows, err := cfg.db.ListChirpDescendants(r.Context(), database.ListChirpDescendantsParams{
+		ChirpID:  chirp.ID,
+		Limit:    maxThreadReplies + 1,
+		MaxDepth: maxThreadDepth,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving thread", err)
+		return
+	}
+
+	truncated := len(descendantRows) > maxThreadReplies
+	if truncated {
+		descendantRows = descendantRows[:maxThreadReplies]
+	}
+
+	ancestors := make([]database.Chirp, 0, len(ancestorRows))
+	for _, row := range ancestorRows {
+		ancestors = append(ancestors, database.Chirp(row))
+	}
+	descendants := make([]database.Chirp, 0, len(descendantRows))
+	for _, row := range descendantRows {
+		descendants = append(descendants, database.Chirp(row))
+	}
+
+	all := append(append([]database.Chirp{chirp}, ancestors...), descendants...)
+	authors, err := cfg.chirpAuthors(r.Context(), all)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "issue retrieving thread", err)
+		return
+	}
+
+	newAncestors := make([]Chirp, 0, len(ancestors))
+	for _, ancestor := range ancestors {
+		newAncestors = append(newAncestors, newChirp(ancestor, authors[ancestor.UserID]))
+	}
+
+	// Replies come oldest first, so a reply's parent is always placed
+	// before the reply itself.
+	root := &ThreadNode{Chirp: newChirp(chirp, authors[chirp.UserID]), Replies: []*ThreadNode{}}
+	nodes := map[uuid.UUID]*ThreadNode{chirp.ID: root}
+	for _, descendant := range descendants {
+		parent, ok := nodes[descendant.InReplyTo.UUID]
+		if !ok {
+			continue
+		}
+		node := &ThreadNode{Chirp: newChirp(descendant, authors[descendant.UserID]), Replies: []*ThreadNode{}}
+		parent.Replies = append(parent.Replies, node)
+		nodes[descendant.ID] = node
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Ancestors: newAncestors,
+		Chirp:     root,
+		Truncated: truncated,
+	})
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/deexth/chirpy/internal/auth"
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
+const refreshTokenTTL = time.Hour * 24 * 60
+
+var errRefreshTokenReused = errors.New("refresh token reused, family revoked")
+
 func (cfg *apiConfig) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -14,24 +23,44 @@ func (cfg *apiConfig) handleRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := cfg.db.GetRefreshTokenUser(r.Context(), refreshToken)
+	newRefreshToken, old, err := cfg.rotateRefreshToken(r, refreshToken, uuid.NullUUID{})
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(userID, cfg.tokenSecret, time.Hour)
+	user, err := cfg.db.GetUserByID(r.Context(), old.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	accessToken, err := cfg.keyring.MakeJWT(user.ID, user.Role, time.Hour)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "somethin went wrong", err)
 		return
 	}
 
 	type response struct {
-		Token string `json:"token"`
+		User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		User: User{
+			ID:            user.ID,
+			Email:         user.Email,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
+			IsChirpyRed:   user.IsChirpyRed,
+			EmailVerified: user.EmailVerifiedAt.Valid,
+			PendingEmail:  user.PendingEmail.String,
+			Role:          user.Role,
+			Handle:        user.Handle,
+		},
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	})
 
 }
@@ -43,7 +72,7 @@ func (cfg *apiConfig) handleRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.db.RevokeRefreshToken(r.Context(), refreshToken)
+	err = cfg.db.RevokeRefreshToken(r.Context(), auth.HashToken(refreshToken))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
 		return
@@ -51,3 +80,108 @@ func (cfg *apiConfig) handleRevoke(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// createRefreshToken issues a new refresh token in the given family and
+// records the client it was issued to. Logins start a new family;
+// rotations stay in the family of the token they replace. Tokens for an
+// OAuth client carry its id and the scopes the user granted it.
+func (cfg *apiConfig) createRefreshToken(r *http.Request, userID, familyID uuid.UUID, clientID uuid.NullUUID, scopes []string) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+		UserAgent: r.UserAgent(),
+		Ip:        clientIP(r),
+		ClientID:  clientID,
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// rotateRefreshToken revokes token and replaces it with a new one in
+// the same family, returning the new token and the row it replaced.
+// Presenting a token that was already revoked means it has leaked, so
+// the whole family is revoked. Tokens only rotate for the OAuth client
+// they were issued to; first-party sessions pass a null clientID.
+func (cfg *apiConfig) rotateRefreshToken(r *http.Request, token string, clientID uuid.NullUUID) (string, database.RefreshToken, error) {
+	ctx := r.Context()
+
+	old, err := cfg.db.GetRefreshToken(ctx, auth.HashToken(token))
+	if err != nil {
+		return "", database.RefreshToken{}, fmt.Errorf("couldn't find refresh token: %v", err)
+	}
+
+	if old.ClientID != clientID {
+		return "", database.RefreshToken{}, errors.New("refresh token was issued to a different client")
+	}
+
+	newToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", database.RefreshToken{}, err
+	}
+
+	// Revoking the old token and storing its replacement happen together,
+	// so a failed insert can't leave the client holding a revoked token
+	// that would then look reused.
+	rotated := false
+	err = cfg.inTx(ctx, func(q *database.Queries) error {
+		numAffectedRows, err := q.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+			TokenHash:  old.TokenHash,
+			ReplacedBy: sql.NullString{String: auth.HashToken(newToken), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't rotate refresh token: %v", err)
+		}
+		if numAffectedRows == 0 {
+			return nil
+		}
+		rotated = true
+
+		err = q.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			TokenHash: auth.HashToken(newToken),
+			UserID:    old.UserID,
+			FamilyID:  old.FamilyID,
+			ExpiresAt: time.Now().Add(refreshTokenTTL),
+			UserAgent: r.UserAgent(),
+			Ip:        clientIP(r),
+			ClientID:  old.ClientID,
+			Scopes:    old.Scopes,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't create refresh token: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", database.RefreshToken{}, err
+	}
+
+	if !rotated {
+		// Either expired or already revoked; re-read the row so a
+		// concurrent rotation of the same token also counts as reuse.
+		current, err := cfg.db.GetRefreshToken(ctx, old.TokenHash)
+		if err != nil {
+			return "", database.RefreshToken{}, fmt.Errorf("couldn't find refresh token: %v", err)
+		}
+		if !current.RevokedAt.Valid {
+			return "", database.RefreshToken{}, errors.New("refresh token expired")
+		}
+		if err := cfg.db.RevokeRefreshTokenFamily(ctx, current.FamilyID); err != nil {
+			return "", database.RefreshToken{}, fmt.Errorf("couldn't revoke token family: %v", err)
+		}
+		return "", database.RefreshToken{}, errRefreshTokenReused
+	}
+
+	return newToken, old, nil
+}
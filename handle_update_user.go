@@ -1,60 +1,394 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/deexth/chirpy/internal/auth"
 	"github.com/deexth/chirpy/internal/database"
+	"github.com/deexth/chirpy/internal/throttle"
+	"github.com/google/uuid"
 )
 
+// handleUpdateUser replaces the caller's password and starts an email
+// change, once they confirm their current password. Like a reset, a new
+// password ends every session and pending reset link.
 func (cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"`
 	}
 
-	accessToken, err := auth.GetBearerToken(r.Header)
+	userID := requestUserID(r)
+
+	params := parameters{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unautorized", err)
+		respondWithError(w, http.StatusBadRequest, "something went wrong", err)
+		return
+	}
+
+	if err := validateEmail(params.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if err := cfg.passwordPolicy.Check(params.Password); err != nil {
+		respondWithPasswordPolicyError(w, err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.tokenSecret)
+	current, err := cfg.db.GetUserByID(r.Context(), userID)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "unautorized", err)
 		return
 	}
 
-	params := parameters{}
+	if !cfg.confirmCurrentPassword(w, r, current, patchField{value: params.CurrentPassword}) {
+		return
+	}
 
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-	err = decoder.Decode(&params)
+	// A new address is held as pending until it's verified; the old one
+	// stays the login identity meanwhile.
+	pendingEmail := sql.NullString{}
+	if params.Email != current.Email {
+		taken, err := cfg.emailTaken(r.Context(), params.Email, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+		if taken {
+			respondWithError(w, http.StatusConflict, "email is already in use", nil)
+			return
+		}
+		pendingEmail = sql.NullString{String: params.Email, Valid: true}
+	}
+
+	hashedPwd, err := cfg.hasher.Hash(params.Password)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "something went wrong", err)
+		respondWithError(w, http.StatusInternalServerError, "someting went wrong", err)
 		return
 	}
 
-	hashedPwd, err := auth.HashPassword(params.Password)
+	var user database.UpdateUserPasswordRow
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		user, err = q.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:           userID,
+			Password:     hashedPwd,
+			PendingEmail: pendingEmail,
+		})
+		if err != nil {
+			return err
+		}
+
+		return endPasswordSessions(r.Context(), q, userID)
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "someting went wrong", err)
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
 		return
 	}
 
-	err = cfg.db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
-		ID:       userID,
-		Email:    params.Email,
-		Password: hashedPwd,
+	cfg.recordAudit(r, userID, auditPasswordChanged, "")
+
+	if pendingEmail.Valid {
+		cfg.recordAudit(r, userID, auditEmailChangeStarted, pendingEmail.String)
+		if err := cfg.sendVerificationEmail(user.ID, pendingEmail.String); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+		Role:          user.Role,
+		Handle:        user.Handle,
 	})
+}
+
+// handlePatchUser applies a JSON merge patch (RFC 7396) to the caller's
+// account. Fields left out are unchanged and null resets a profile field
+// to empty. Changing the email or password needs current_password.
+func (cfg *apiConfig) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			respondWithError(w, http.StatusUnsupportedMediaType, "content type must be application/merge-patch+json", err)
+			return
+		}
+	}
+
+	patch := map[string]json.RawMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		respondWithError(w, http.StatusBadRequest, "body must be a JSON object", err)
+		return
+	}
+
+	fields := map[string]patchField{}
+	for key, raw := range patch {
+		switch key {
+		case "email", "password", "current_password", "handle", "display_name", "bio", "avatar_url":
+		default:
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unknown field %q", key), nil)
+			return
+		}
+
+		field, err := parsePatchField(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s must be a string or null", key), err)
+			return
+		}
+		fields[key] = field
+	}
+
+	userID := requestUserID(r)
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, struct {
-		Email string `json:"email"`
-	}{
-		Email: params.Email,
+	_, changesEmail := fields["email"]
+	_, changesPassword := fields["password"]
+	if changesEmail || changesPassword {
+		if !cfg.confirmCurrentPassword(w, r, user, fields["current_password"]) {
+			return
+		}
+	}
+
+	params := database.PatchUserParams{ID: userID}
+	emailChanged := false
+	profileChanged := false
+
+	if f, ok := fields["email"]; ok {
+		email := strings.TrimSpace(f.value)
+		if f.null || email == "" {
+			respondWithError(w, http.StatusBadRequest, "email can't be removed", nil)
+			return
+		}
+		if err := validateEmail(email); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+
+		// Patching the email back to the current one cancels a pending
+		// change.
+		params.SetPendingEmail = true
+		if email != user.Email {
+			taken, err := cfg.emailTaken(r.Context(), email, userID)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+				return
+			}
+			if taken {
+				respondWithError(w, http.StatusConflict, "email is already in use", nil)
+				return
+			}
+			params.PendingEmail = sql.NullString{String: email, Valid: true}
+			emailChanged = true
+		}
+	}
+
+	if f, ok := fields["password"]; ok {
+		if f.null {
+			respondWithError(w, http.StatusBadRequest, "password can't be removed", nil)
+			return
+		}
+		if err := cfg.passwordPolicy.Check(f.value); err != nil {
+			respondWithPasswordPolicyError(w, err)
+			return
+		}
+
+		hashedPwd, err := cfg.hasher.Hash(f.value)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "issue hashing password", err)
+			return
+		}
+		params.Password = sql.NullString{String: hashedPwd, Valid: true}
+	}
+
+	if f, ok := fields["handle"]; ok {
+		if f.null {
+			respondWithError(w, http.StatusBadRequest, "handle can't be removed", nil)
+			return
+		}
+		handle, err := normalizeHandle(f.value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		params.Handle = sql.NullString{String: handle, Valid: true}
+		profileChanged = true
+	}
+
+	if f, ok := fields["display_name"]; ok {
+		displayName := strings.TrimSpace(f.value)
+		if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("display_name must be at most %d characters", maxDisplayNameLength), nil)
+			return
+		}
+		params.DisplayName = sql.NullString{String: displayName, Valid: true}
+		profileChanged = true
+	}
+
+	if f, ok := fields["bio"]; ok {
+		if utf8.RuneCountInString(f.value) > maxBioLength {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("bio must be at most %d characters", maxBioLength), nil)
+			return
+		}
+		params.Bio = sql.NullString{String: f.value, Valid: true}
+		profileChanged = true
+	}
+
+	if f, ok := fields["avatar_url"]; ok {
+		if err := validateAvatarURL(f.value); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		params.AvatarUrl = sql.NullString{String: f.value, Valid: true}
+		profileChanged = true
+	}
+
+	// An empty patch leaves the account, and updated_at, as it is.
+	if params.SetPendingEmail || params.Password.Valid || profileChanged {
+		err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+			var err error
+			user, err = q.PatchUser(r.Context(), params)
+			if err != nil {
+				return err
+			}
+			if !params.Password.Valid {
+				return nil
+			}
+
+			return endPasswordSessions(r.Context(), q, userID)
+		})
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "handle is already taken", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+	}
+
+	if params.Password.Valid {
+		cfg.recordAudit(r, userID, auditPasswordChanged, "")
+	}
+
+	if emailChanged {
+		cfg.recordAudit(r, userID, auditEmailChangeStarted, params.PendingEmail.String)
+		if err := cfg.sendVerificationEmail(user.ID, params.PendingEmail.String); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+		Role:          user.Role,
+		Handle:        user.Handle,
 	})
 }
+
+// patchField is one member of a merge patch: either null or a string.
+type patchField struct {
+	value string
+	null  bool
+}
+
+func parsePatchField(raw json.RawMessage) (patchField, error) {
+	if string(raw) == "null" {
+		return patchField{null: true}, nil
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return patchField{}, err
+	}
+
+	return patchField{value: value}, nil
+}
+
+// confirmCurrentPassword checks current_password before a sensitive
+// change, throttled like logins so it can't be used to guess the
+// password of a stolen session. It responds itself when the check fails.
+func (cfg *apiConfig) confirmCurrentPassword(w http.ResponseWriter, r *http.Request, user database.User, current patchField) bool {
+	if current.value == "" {
+		respondWithError(w, http.StatusBadRequest, "current_password is required", nil)
+		return false
+	}
+
+	throttleKeys := []throttle.Key{throttle.EmailKey(user.Email), throttle.IPKey(clientIP(r))}
+	retryAfter, err := cfg.throttle.Reserve(r.Context(), throttleKeys...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return false
+	}
+	if retryAfter > 0 {
+		respondWithRetryAfter(w, retryAfter)
+		return false
+	}
+
+	ok, err := auth.CheckPasswordHash(current.value, user.Password)
+	if err != nil || !ok {
+		respondWithError(w, http.StatusForbidden, "current password is incorrect", err)
+		return false
+	}
+
+	if err := cfg.throttle.Release(r.Context(), throttleKeys...); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return false
+	}
+
+	return true
+}
+
+// endPasswordSessions revokes every session and pending reset link after
+// a password change, so whoever knew the old password is locked out.
+func endPasswordSessions(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	if err := q.InvalidateUserPasswordResetTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	return q.RevokeUserRefreshTokens(ctx, userID)
+}
+
+// emailTaken reports whether email already belongs to an account other
+// than userID's.
+func (cfg *apiConfig) emailTaken(ctx context.Context, email string, userID uuid.UUID) (bool, error) {
+	existing, err := cfg.db.GetUser(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return existing.ID != userID, nil
+}
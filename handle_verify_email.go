@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/deexth/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const emailVerificationTTL = time.Hour * 24
+
+// validateEmail accepts a single bare address, the only form that can be
+// stored and mailed a verification link.
+func validateEmail(email string) error {
+	if email == "" {
+		return errors.New("email is required")
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("email must be a valid address")
+	}
+
+	return nil
+}
+
+// sendVerificationEmail mails a signed link that confirms email belongs
+// to userID. The address only becomes the account's verified email once
+// the link is followed.
+func (cfg *apiConfig) sendVerificationEmail(userID uuid.UUID, email string) error {
+	token, err := cfg.keyring.MakeEmailVerificationToken(userID, email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := cfg.baseURL + "/api/users/verify?token=" + url.QueryEscape(token)
+	cfg.sendMail(mailer.Message{
+		To:      email,
+		Subject: "Confirm your Chirpy email address",
+		Body: fmt.Sprintf("Follow this link within the next 24 hours to confirm this address for your Chirpy account:\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n", link),
+	})
+
+	return nil
+}
+
+func (cfg *apiConfig) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	userID, email, err := cfg.keyring.ValidateEmailVerificationToken(r.URL.Query().Get("token"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid or expired link", err)
+		return
+	}
+
+	numAffectedRows, err := cfg.db.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    userID,
+		Email: email,
+	})
+	// Someone else verified the same address first.
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "email is already in use", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	// The address was replaced by a newer change request since the link
+	// was sent.
+	if numAffectedRows == 0 {
+		respondWithError(w, http.StatusBadRequest, "invalid or expired link", errors.New("no rows affected"))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}{
+		Email:         email,
+		EmailVerified: true,
+	})
+}
+
+func (cfg *apiConfig) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	email := ""
+	switch {
+	case user.PendingEmail.Valid:
+		email = user.PendingEmail.String
+	case !user.EmailVerifiedAt.Valid:
+		email = user.Email
+	default:
+		respondWithError(w, http.StatusBadRequest, "email already verified", nil)
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(user.ID, email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
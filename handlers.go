@@ -1,11 +1,22 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/deexth/chirpy/internal/auth"
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/deexth/chirpy/internal/mailer"
+	"github.com/lib/pq"
 )
 
 func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
@@ -46,6 +57,31 @@ func getCleanedBody(body string, badWords map[string]struct{}) string {
 
 	return strings.Join(words, " ")
 }
+
+// sendMail delivers msg in the background so the response doesn't wait
+// on the mail server or reveal how long delivery took.
+func (cfg *apiConfig) sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := cfg.mailer.Send(ctx, msg); err != nil {
+			log.Printf("couldn't send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// clientIP returns the address of the directly connected peer. Forwarded
+// headers are ignored because any client can set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
 	if err != nil {
 		log.Println(err)
@@ -61,6 +97,29 @@ func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
 	})
 }
 
+// respondWithPasswordPolicyError lists every password rule that failed.
+func respondWithPasswordPolicyError(w http.ResponseWriter, err error) {
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		respondWithError(w, http.StatusInternalServerError, "couldn't check password", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusBadRequest, struct {
+		Error      string                 `json:"error"`
+		Violations []auth.PolicyViolation `json:"violations"`
+	}{
+		Error:      "password does not meet the password policy",
+		Violations: policyErr.Violations,
+	})
+}
+
+// respondWithRetryAfter tells a throttled client how many seconds to wait.
+func respondWithRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "too many failed attempts, try again later", nil)
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
@@ -72,3 +131,26 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.WriteHeader(code)
 	w.Write(dat)
 }
+
+// isUniqueViolation reports whether err is Postgres rejecting a
+// duplicate value for a unique column.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// inTx runs fn with queries bound to a single transaction, committing
+// only if fn succeeds.
+func (cfg *apiConfig) inTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(cfg.db.WithTx(tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
 )
 
@@ -12,8 +13,9 @@ func TestCheckPasswordHash(t *testing.T) {
 	// First, we need to create some hashed passwords for testing
 	password1 := "correctPassword123!"
 	password2 := "anotherPassword456!"
-	hash1, _ := HashPassword(password1)
-	hash2, _ := HashPassword(password2)
+	hasher := NewPasswordHasher(argon2id.DefaultParams)
+	hash1, _ := hasher.Hash(password1)
+	hash2, _ := hasher.Hash(password2)
 
 	tests := []struct {
 		name          string
@@ -74,7 +76,8 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	ring, _ := NewKeyring("k1", NewHMACKey("k1", []byte("secret")))
+	validToken, _ := ring.MakeJWT(userID, RoleUser, time.Hour)
 
 	tests := []struct {
 		name        string
@@ -108,7 +111,8 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			ring, _ := NewKeyring("k1", NewHMACKey("k1", []byte(tt.tokenSecret)))
+			gotUserID, err := ring.ValidateJWT(tt.tokenString)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -164,3 +168,136 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers http.Header
+		wantKey string
+		wantErr bool
+	}{
+		{
+			name: "Valid ApiKey",
+			headers: http.Header{
+				"Authorization": []string{"ApiKey valid_key"},
+			},
+			wantKey: "valid_key",
+			wantErr: false,
+		},
+		{
+			name:    "Missing Authorization header",
+			headers: http.Header{},
+			wantKey: "",
+			wantErr: true,
+		},
+		{
+			name: "Bearer scheme",
+			headers: http.Header{
+				"Authorization": []string{"Bearer valid_key"},
+			},
+			wantKey: "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKey, err := GetAPIKey(tt.headers)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotKey != tt.wantKey {
+				t.Errorf("GetAPIKey() gotKey = %v, want %v", gotKey, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	got := HashToken("abc")
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got != want {
+		t.Errorf("HashToken() = %v, want %v", got, want)
+	}
+	if HashToken("abc") == HashToken("abd") {
+		t.Errorf("HashToken() returned the same digest for different tokens")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weak, _ := ParseHashParams("8192", "1", "1")
+	strong, _ := ParseHashParams("16384", "2", "1")
+
+	weakHash, _ := NewPasswordHasher(weak).Hash("password")
+	strongHash, _ := NewPasswordHasher(strong).Hash("password")
+
+	tests := []struct {
+		name    string
+		hash    string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:    "Hash made with weaker params",
+			hash:    weakHash,
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name:    "Hash made with current params",
+			hash:    strongHash,
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:    "Invalid hash",
+			hash:    "invalidhash",
+			want:    false,
+			wantErr: true,
+		},
+	}
+
+	hasher := NewPasswordHasher(strong)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hasher.NeedsRehash(tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NeedsRehash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	match, _ := CheckPasswordHash("password", strongHash)
+	if !match {
+		t.Errorf("CheckPasswordHash() should accept hashes from a PasswordHasher")
+	}
+}
+
+func TestParseHashParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		memory      string
+		iterations  string
+		parallelism string
+		wantErr     bool
+	}{
+		{name: "Defaults", wantErr: false},
+		{name: "Custom", memory: "131072", iterations: "3", parallelism: "2", wantErr: false},
+		{name: "Too little memory", memory: "1024", wantErr: true},
+		{name: "Zero iterations", iterations: "0", wantErr: true},
+		{name: "Parallelism out of range", parallelism: "300", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseHashParams(tt.memory, tt.iterations, tt.parallelism)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseHashParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,13 +3,74 @@
 package auth
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/alexedwards/argon2id"
 )
 
-func HashPassword(password string) (string, error) {
-	return argon2id.CreateHash(password, argon2id.DefaultParams)
-}
-
 func CheckPasswordHash(password string, hash string) (bool, error) {
 	return argon2id.ComparePasswordAndHash(password, hash)
 }
+
+// PasswordHasher hashes new passwords with its configured parameters and
+// spots stored hashes that were made with weaker ones, so the cost can be
+// raised over time without forcing password resets.
+type PasswordHasher struct {
+	params *argon2id.Params
+}
+
+func NewPasswordHasher(params *argon2id.Params) *PasswordHasher {
+	return &PasswordHasher{params: params}
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return argon2id.CreateHash(password, h.params)
+}
+
+// NeedsRehash reports whether hash was created with less memory,
+// iterations, salt or key length than the hasher uses now. Parallelism
+// is left out because it changes with the host, not the cost.
+func (h *PasswordHasher) NeedsRehash(hash string) (bool, error) {
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	return params.Memory < h.params.Memory ||
+		params.Iterations < h.params.Iterations ||
+		params.SaltLength < h.params.SaltLength ||
+		params.KeyLength < h.params.KeyLength, nil
+}
+
+// ParseHashParams builds argon2id parameters from configuration strings.
+// Empty values keep argon2id.DefaultParams.
+func ParseHashParams(memoryKiB, iterations, parallelism string) (*argon2id.Params, error) {
+	params := *argon2id.DefaultParams
+
+	if memoryKiB != "" {
+		v, err := strconv.ParseUint(memoryKiB, 10, 32)
+		if err != nil || v < 8*1024 {
+			return nil, fmt.Errorf("argon2 memory must be at least 8192 KiB: %q", memoryKiB)
+		}
+		params.Memory = uint32(v)
+	}
+
+	if iterations != "" {
+		v, err := strconv.ParseUint(iterations, 10, 32)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("argon2 iterations must be a positive integer: %q", iterations)
+		}
+		params.Iterations = uint32(v)
+	}
+
+	if parallelism != "" {
+		v, err := strconv.ParseUint(parallelism, 10, 8)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("argon2 parallelism must be between 1 and 255: %q", parallelism)
+		}
+		params.Parallelism = uint8(v)
+	}
+
+	return &params, nil
+}
@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Each kind of token gets its own issuer so one can never be replayed
+// as another.
+const (
+	accessTokenIssuer = "chirpy-access"
+	emailTokenIssuer  = "chirpy-email-verify"
+	mfaTokenIssuer    = "chirpy-mfa"
+	oidcStateIssuer   = "chirpy-oidc-state"
+)
+
+// SigningKey is a named key used to sign and verify tokens. HMAC keys
+// share one secret; asymmetric keys sign with the private half and are
+// published through JWKS so other services can verify offline.
+// Retired keys stay in the keyring but no longer validate anything.
+type SigningKey struct {
+	ID        string
+	Retired   bool
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+func NewHMACKey(id string, secret []byte) SigningKey {
+	return SigningKey{
+		ID:        id,
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// Keyring signs tokens with its active key and stamps the key's ID in
+// the kid header, so older keys keep validating while a new one rolls out.
+type Keyring struct {
+	activeID string
+	keys     map[string]SigningKey
+}
+
+func NewKeyring(activeID string, keys ...SigningKey) (*Keyring, error) {
+	k := &Keyring{
+		activeID: activeID,
+		keys:     make(map[string]SigningKey, len(keys)),
+	}
+
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("signing key has no id")
+		}
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key id: %s", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+
+	active, ok := k.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q not found", activeID)
+	}
+	if active.Retired {
+		return nil, fmt.Errorf("active signing key %q is retired", activeID)
+	}
+
+	return k, nil
+}
+
+// LoadKeyring builds a keyring from configuration strings. secrets is a
+// comma separated list of id:secret pairs for HS256 keys, keyFiles is a
+// comma separated list of id:path pairs pointing at PEM private keys,
+// activeID names the key used for signing and retired is a comma
+// separated list of key ids that must no longer validate.
+func LoadKeyring(secrets, keyFiles, activeID, retired string) (*Keyring, error) {
+	retiredIDs := map[string]bool{}
+	for _, id := range strings.Split(retired, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			retiredIDs[id] = true
+		}
+	}
+
+	signingKeys := []SigningKey{}
+	for i, entry := range strings.Split(secrets, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("malformed signing key entry at position %d", i)
+		}
+
+		key := NewHMACKey(id, []byte(secret))
+		key.Retired = retiredIDs[id]
+		signingKeys = append(signingKeys, key)
+	}
+
+	for _, entry := range strings.Split(keyFiles, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, path, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("malformed signing key file entry: %q", entry)
+		}
+
+		key, err := LoadPrivateKeyFile(id, path)
+		if err != nil {
+			return nil, err
+		}
+		key.Retired = retiredIDs[id]
+		signingKeys = append(signingKeys, key)
+	}
+
+	return NewKeyring(activeID, signingKeys...)
+}
+
+// Roles carried in access tokens. They mirror the users.role column.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// AccessClaims are the claims of an access token. Role is a snapshot
+// taken when the token was issued, so a role change only applies once
+// the user gets a new access token. Tokens issued to OAuth clients name
+// the client and the space separated scopes the user granted it.
+type AccessClaims struct {
+	Role     string `json:"role"`
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (k *Keyring) MakeJWT(userID uuid.UUID, role string, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	return k.sign(AccessClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    accessTokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	})
+}
+
+// MakeOAuthAccessToken signs an access token acting for userID on behalf
+// of an OAuth client, limited to scopes.
+func (k *Keyring) MakeOAuthAccessToken(userID, clientID uuid.UUID, scopes []string, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	return k.sign(AccessClaims{
+		Role:     RoleUser,
+		ClientID: clientID.String(),
+		Scope:    strings.Join(scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    accessTokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	})
+}
+
+func (k *Keyring) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := k.ParseAccessToken(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.Parse(claims.Subject)
+}
+
+// ParseAccessToken validates an access token and returns all of its
+// claims. The subject is guaranteed to be a valid user ID.
+func (k *Keyring) ParseAccessToken(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	if err := k.parse(tokenString, claims, jwt.WithIssuer(accessTokenIssuer)); err != nil {
+		return nil, err
+	}
+
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return nil, fmt.Errorf("unable to parse user_id: %v", err)
+	}
+
+	if claims.Role == "" {
+		claims.Role = RoleUser
+	}
+
+	return claims, nil
+}
+
+// MakeMFAToken signs the short-lived challenge handed out after a correct
+// password when the account still needs a second factor.
+func (k *Keyring) MakeMFAToken(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	return k.sign(jwt.RegisteredClaims{
+		Issuer:    mfaTokenIssuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		Subject:   userID.String(),
+	})
+}
+
+func (k *Keyring) ValidateMFAToken(tokenString string) (uuid.UUID, error) {
+	claims := &jwt.RegisteredClaims{}
+	if err := k.parse(tokenString, claims, jwt.WithIssuer(mfaTokenIssuer)); err != nil {
+		return uuid.Nil, err
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("unable to parse user_id: %v", err)
+	}
+
+	return id, nil
+}
+
+type emailClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// MakeEmailVerificationToken signs a link token proving the holder
+// received mail sent to email for userID.
+func (k *Keyring) MakeEmailVerificationToken(userID uuid.UUID, email string, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	return k.sign(emailClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    emailTokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	})
+}
+
+func (k *Keyring) ValidateEmailVerificationToken(tokenString string) (uuid.UUID, string, error) {
+	claims := &emailClaims{}
+	if err := k.parse(tokenString, claims, jwt.WithIssuer(emailTokenIssuer)); err != nil {
+		return uuid.Nil, "", err
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("unable to parse user_id: %v", err)
+	}
+
+	if claims.Email == "" {
+		return uuid.Nil, "", errors.New("token has no email")
+	}
+
+	return id, claims.Email, nil
+}
+
+// OIDCState is what the server must remember between sending a user to
+// an OpenID provider and the provider sending them back.
+type OIDCState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type oidcStateClaims struct {
+	OIDCState
+	jwt.RegisteredClaims
+}
+
+// MakeOIDCStateToken signs state so it can be kept in a cookie instead
+// of server side.
+func (k *Keyring) MakeOIDCStateToken(state OIDCState, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	return k.sign(oidcStateClaims{
+		OIDCState: state,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidcStateIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+	})
+}
+
+func (k *Keyring) ValidateOIDCStateToken(tokenString string) (OIDCState, error) {
+	claims := &oidcStateClaims{}
+	if err := k.parse(tokenString, claims, jwt.WithIssuer(oidcStateIssuer)); err != nil {
+		return OIDCState{}, err
+	}
+
+	if claims.State == "" || claims.Nonce == "" || claims.Verifier == "" {
+		return OIDCState{}, errors.New("incomplete oidc state")
+	}
+
+	return claims.OIDCState, nil
+}
+
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	key := k.keys[k.activeID]
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+
+	ss, err := token.SignedString(key.signKey)
+	if err != nil {
+		return "", fmt.Errorf("issue signing token: %v", err)
+	}
+
+	return ss, nil
+}
+
+func (k *Keyring) parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, k.keyFunc, opts...)
+	if err != nil {
+		return fmt.Errorf("couldn't parse the token string: %v", err)
+	}
+
+	return nil
+}
+
+func (k *Keyring) keyFunc(t *jwt.Token) (any, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	key, ok := k.keys[kid]
+	if !ok || key.Retired {
+		return nil, fmt.Errorf("unknown or retired signing key: %s", kid)
+	}
+
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+
+	return key.verifyKey, nil
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	userID := uuid.New()
+
+	oldRing, err := LoadKeyring("old:old_secret", "", "old", "")
+	if err != nil {
+		t.Fatalf("LoadKeyring() error = %v", err)
+	}
+	oldToken, _ := oldRing.MakeJWT(userID, RoleUser, time.Hour)
+
+	rotated, err := LoadKeyring("new:new_secret,old:old_secret", "", "new", "")
+	if err != nil {
+		t.Fatalf("LoadKeyring() error = %v", err)
+	}
+	newToken, _ := rotated.MakeJWT(userID, RoleUser, time.Hour)
+
+	retired, err := LoadKeyring("new:new_secret,old:old_secret", "", "new", "old")
+	if err != nil {
+		t.Fatalf("LoadKeyring() error = %v", err)
+	}
+
+	expired, _ := rotated.MakeJWT(userID, RoleUser, -time.Minute)
+
+	tests := []struct {
+		name        string
+		keyring     *Keyring
+		tokenString string
+		wantErr     bool
+	}{
+		{
+			name:        "Token from previous key validates after rotation",
+			keyring:     rotated,
+			tokenString: oldToken,
+			wantErr:     false,
+		},
+		{
+			name:        "Token from active key",
+			keyring:     rotated,
+			tokenString: newToken,
+			wantErr:     false,
+		},
+		{
+			name:        "Token from retired key",
+			keyring:     retired,
+			tokenString: oldToken,
+			wantErr:     true,
+		},
+		{
+			name:        "Token from unknown key",
+			keyring:     oldRing,
+			tokenString: newToken,
+			wantErr:     true,
+		},
+		{
+			name:        "Expired token",
+			keyring:     rotated,
+			tokenString: expired,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserID, err := tt.keyring.ValidateJWT(tt.tokenString)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && gotUserID != userID {
+				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, userID)
+			}
+		})
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		activeID string
+		retired  string
+		wantErr  bool
+	}{
+		{
+			name:     "Valid keyring",
+			keys:     "a:secret_a, b:secret_b",
+			activeID: "a",
+			wantErr:  false,
+		},
+		{
+			name:     "Missing active key",
+			keys:     "a:secret_a",
+			activeID: "b",
+			wantErr:  true,
+		},
+		{
+			name:     "Active key retired",
+			keys:     "a:secret_a,b:secret_b",
+			activeID: "a",
+			retired:  "a",
+			wantErr:  true,
+		},
+		{
+			name:     "Duplicate key id",
+			keys:     "a:secret_a,a:other",
+			activeID: "a",
+			wantErr:  true,
+		},
+		{
+			name:     "Malformed entry",
+			keys:     "secret_without_id",
+			activeID: "a",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeyring(tt.keys, "", tt.activeID, tt.retired)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmailVerificationToken(t *testing.T) {
+	ring, _ := NewKeyring("k1", NewHMACKey("k1", []byte("secret")))
+	userID := uuid.New()
+
+	emailToken, err := ring.MakeEmailVerificationToken(userID, "user@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailVerificationToken() error = %v", err)
+	}
+
+	gotID, gotEmail, err := ring.ValidateEmailVerificationToken(emailToken)
+	if err != nil {
+		t.Fatalf("ValidateEmailVerificationToken() error = %v", err)
+	}
+	if gotID != userID || gotEmail != "user@example.com" {
+		t.Errorf("ValidateEmailVerificationToken() = %v, %v, want %v, user@example.com", gotID, gotEmail, userID)
+	}
+
+	if _, err := ring.ValidateJWT(emailToken); err == nil {
+		t.Errorf("ValidateJWT() accepted an email verification token")
+	}
+
+	accessToken, _ := ring.MakeJWT(userID, RoleUser, time.Hour)
+	if _, _, err := ring.ValidateEmailVerificationToken(accessToken); err == nil {
+		t.Errorf("ValidateEmailVerificationToken() accepted an access token")
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	ring, _ := NewKeyring("k1", NewHMACKey("k1", []byte("secret")))
+	userID := uuid.New()
+
+	mfaToken, _ := ring.MakeMFAToken(userID, time.Minute)
+	gotID, err := ring.ValidateMFAToken(mfaToken)
+	if err != nil || gotID != userID {
+		t.Errorf("ValidateMFAToken() = %v, %v, want %v", gotID, err, userID)
+	}
+
+	if _, err := ring.ValidateJWT(mfaToken); err == nil {
+		t.Errorf("ValidateJWT() accepted an MFA challenge token")
+	}
+}
+
+func TestAccessTokenRole(t *testing.T) {
+	ring, _ := NewKeyring("k1", NewHMACKey("k1", []byte("secret")))
+	userID := uuid.New()
+
+	tests := []struct {
+		name string
+		role string
+		want string
+	}{
+		{
+			name: "Admin role",
+			role: RoleAdmin,
+			want: RoleAdmin,
+		},
+		{
+			name: "User role",
+			role: RoleUser,
+			want: RoleUser,
+		},
+		{
+			name: "Missing role defaults to user",
+			role: "",
+			want: RoleUser,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _ := ring.MakeJWT(userID, tt.role, time.Hour)
+			claims, err := ring.ParseAccessToken(token)
+			if err != nil {
+				t.Fatalf("ParseAccessToken() error = %v", err)
+			}
+			if claims.Role != tt.want {
+				t.Errorf("ParseAccessToken() role = %q, want %q", claims.Role, tt.want)
+			}
+			if claims.Subject != userID.String() {
+				t.Errorf("ParseAccessToken() subject = %q, want %q", claims.Subject, userID)
+			}
+		})
+	}
+}
+
+func TestOAuthAccessToken(t *testing.T) {
+	ring, _ := NewKeyring("k1", NewHMACKey("k1", []byte("secret")))
+	userID := uuid.New()
+	clientID := uuid.New()
+
+	token, err := ring.MakeOAuthAccessToken(userID, clientID, []string{ScopeChirpsWrite}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeOAuthAccessToken() error = %v", err)
+	}
+
+	claims, err := ring.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if claims.ClientID != clientID.String() {
+		t.Errorf("ParseAccessToken() client_id = %q, want %q", claims.ClientID, clientID)
+	}
+	if claims.Scope != ScopeChirpsWrite {
+		t.Errorf("ParseAccessToken() scope = %q, want %q", claims.Scope, ScopeChirpsWrite)
+	}
+	if claims.Role != RoleUser {
+		t.Errorf("ParseAccessToken() role = %q, want %q", claims.Role, RoleUser)
+	}
+}
+
+func TestOIDCStateToken(t *testing.T) {
+	ring, _ := NewKeyring("k1", NewHMACKey("k1", []byte("secret")))
+	state := OIDCState{State: "state", Nonce: "nonce", Verifier: "verifier"}
+
+	token, err := ring.MakeOIDCStateToken(state, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeOIDCStateToken() error = %v", err)
+	}
+
+	got, err := ring.ValidateOIDCStateToken(token)
+	if err != nil || got != state {
+		t.Errorf("ValidateOIDCStateToken() = %+v, %v, want %+v", got, err, state)
+	}
+
+	expired, _ := ring.MakeOIDCStateToken(state, -time.Minute)
+	if _, err := ring.ValidateOIDCStateToken(expired); err == nil {
+		t.Errorf("ValidateOIDCStateToken() accepted an expired token")
+	}
+
+	accessToken, _ := ring.MakeJWT(uuid.New(), RoleUser, time.Hour)
+	if _, err := ring.ValidateOIDCStateToken(accessToken); err == nil {
+		t.Errorf("ValidateOIDCStateToken() accepted an access token")
+	}
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSAKeyBits = 2048
+
+// JWK is the public half of an asymmetric signing key as described in
+// RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewEd25519Key(id string, private ed25519.PrivateKey) SigningKey {
+	return SigningKey{
+		ID:        id,
+		method:    jwt.SigningMethodEdDSA,
+		signKey:   private,
+		verifyKey: private.Public(),
+	}
+}
+
+func NewRSAKey(id string, private *rsa.PrivateKey) (SigningKey, error) {
+	if private.N.BitLen() < minRSAKeyBits {
+		return SigningKey{}, fmt.Errorf("rsa key %q must be at least %d bits", id, minRSAKeyBits)
+	}
+
+	return SigningKey{
+		ID:        id,
+		method:    jwt.SigningMethodRS256,
+		signKey:   private,
+		verifyKey: &private.PublicKey,
+	}, nil
+}
+
+// ParsePrivateKeyPEM reads an Ed25519 or RSA private key in PKCS#8, or an
+// RSA key in PKCS#1, and picks the signing method from the key type.
+func ParsePrivateKeyPEM(id string, data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("no PEM block found for key %q", id)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("couldn't parse rsa key %q: %v", id, err)
+		}
+		return NewRSAKey(id, private)
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("couldn't parse key %q: %v", id, err)
+		}
+		switch private := private.(type) {
+		case ed25519.PrivateKey:
+			return NewEd25519Key(id, private), nil
+		case *rsa.PrivateKey:
+			return NewRSAKey(id, private)
+		default:
+			return SigningKey{}, fmt.Errorf("unsupported key type %T for key %q", private, id)
+		}
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported PEM block %q for key %q", block.Type, id)
+	}
+}
+
+func LoadPrivateKeyFile(id, path string) (SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("couldn't read key file for %q: %v", id, err)
+	}
+
+	return ParsePrivateKeyPEM(id, data)
+}
+
+// JWK returns the public half of an asymmetric key. HMAC keys have no
+// public half and are never published.
+func (key SigningKey) JWK() (JWK, error) {
+	switch public := key.verifyKey.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.method.Alg(),
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(public),
+		}, nil
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.method.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}, nil
+	default:
+		return JWK{}, errors.New("key has no public half")
+	}
+}
+
+// JWKS returns the public keys downstream services need to verify
+// tokens issued by this keyring.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		if key.Retired {
+			continue
+		}
+		if jwk, err := key.JWK(); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestAsymmetricKeys(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	smallRSAKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantAlg string
+		wantErr bool
+	}{
+		{
+			name:    "Ed25519 PKCS#8",
+			pem:     pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}),
+			wantAlg: "EdDSA",
+			wantErr: false,
+		},
+		{
+			name:    "RSA PKCS#1",
+			pem:     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			wantAlg: "RS256",
+			wantErr: false,
+		},
+		{
+			name:    "RSA key too small",
+			pem:     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(smallRSAKey)}),
+			wantErr: true,
+		},
+		{
+			name:    "Not PEM",
+			pem:     []byte("not a key"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParsePrivateKeyPEM("k1", tt.pem)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePrivateKeyPEM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			ring, err := NewKeyring("k1", key)
+			if err != nil {
+				t.Fatalf("NewKeyring() error = %v", err)
+			}
+
+			userID := uuid.New()
+			token, err := ring.MakeJWT(userID, RoleUser, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+
+			jwks := ring.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Alg != tt.wantAlg {
+				t.Fatalf("JWKS() = %+v, want one %s key", jwks, tt.wantAlg)
+			}
+
+			// Verify the way a downstream service would: with only the JWK.
+			public := publicKeyFromJWK(t, jwks.Keys[0])
+			claims := &jwt.RegisteredClaims{}
+			_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+				return public, nil
+			}, jwt.WithValidMethods([]string{tt.wantAlg}))
+			if err != nil {
+				t.Fatalf("couldn't verify token with JWK: %v", err)
+			}
+			if claims.Subject != userID.String() {
+				t.Errorf("subject = %v, want %v", claims.Subject, userID)
+			}
+		})
+	}
+}
+
+func TestJWKSSkipsSecrets(t *testing.T) {
+	ring, _ := NewKeyring("hmac", NewHMACKey("hmac", []byte("secret")))
+	if got := ring.JWKS(); len(got.Keys) != 0 {
+		t.Errorf("JWKS() published %d keys for an HMAC keyring", len(got.Keys))
+	}
+}
+
+func publicKeyFromJWK(t *testing.T, jwk JWK) any {
+	t.Helper()
+	switch jwk.Kty {
+	case "OKP":
+		x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+		return ed25519.PublicKey(x)
+	case "RSA":
+		n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	default:
+		t.Fatalf("unexpected kty %q", jwk.Kty)
+		return nil
+	}
+}
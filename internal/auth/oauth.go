@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// ValidateRedirectURI checks a redirect URI an OAuth client registers.
+// It must be absolute and without a fragment, and only loopback
+// addresses may use plain http.
+func ValidateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid redirect uri: %v", err)
+	}
+
+	if !u.IsAbs() || u.Host == "" {
+		return errors.New("redirect uri must be absolute")
+	}
+	if u.Fragment != "" {
+		return errors.New("redirect uri must not contain a fragment")
+	}
+
+	switch u.Scheme {
+	case "https":
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return errors.New("redirect uri must use https unless it points at localhost")
+		}
+	default:
+		return fmt.Errorf("unsupported redirect uri scheme: %s", u.Scheme)
+	}
+
+	return nil
+}
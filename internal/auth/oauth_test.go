@@ -0,0 +1,55 @@
+package auth
+
+import "testing"
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		wantErr bool
+	}{
+		{
+			name:    "HTTPS",
+			uri:     "https://app.example.com/callback",
+			wantErr: false,
+		},
+		{
+			name:    "HTTP on localhost",
+			uri:     "http://localhost:3000/callback",
+			wantErr: false,
+		},
+		{
+			name:    "HTTP on loopback address",
+			uri:     "http://127.0.0.1:3000/callback",
+			wantErr: false,
+		},
+		{
+			name:    "HTTP on a public host",
+			uri:     "http://app.example.com/callback",
+			wantErr: true,
+		},
+		{
+			name:    "Relative",
+			uri:     "/callback",
+			wantErr: true,
+		},
+		{
+			name:    "Fragment",
+			uri:     "https://app.example.com/callback#token",
+			wantErr: true,
+		},
+		{
+			name:    "Other scheme",
+			uri:     "javascript:alert(1)",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateRedirectURI(tt.uri); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRedirectURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// sha1PrefixLength is how many hex characters of a SHA-1 digest form a
+// bucket, matching the k-anonymity range lookups of breach corpora.
+const sha1PrefixLength = 5
+
+// breachedCacheSize is how many range buckets stay in memory. Each one
+// holds several hundred suffixes.
+const breachedCacheSize = 256
+
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password failed so clients can
+// show them all at once.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+
+	return "password violates policy: " + strings.Join(rules, ", ")
+}
+
+// PasswordPolicy checks new passwords. Lengths are counted in runes, not
+// bytes, so multi-byte characters count once.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	breached  *breachedRanges
+}
+
+func NewPasswordPolicy(minLength, maxLength int) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+	}
+}
+
+// LoadBreachedPasswordsDir checks passwords against a breach corpus in
+// the Have I Been Pwned range format: dir holds one file per five
+// character SHA-1 prefix, named PREFIX or PREFIX.txt, each listing the
+// remaining 35 characters of a digest and a count as SUFFIX:COUNT.
+// Buckets are read on demand and the most recently used are cached.
+func (p *PasswordPolicy) LoadBreachedPasswordsDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("couldn't open breached passwords dir: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("breached passwords path is not a directory: %s", dir)
+	}
+
+	p.breached = &breachedRanges{
+		dir:     dir,
+		lru:     list.New(),
+		buckets: map[string]*list.Element{},
+	}
+
+	return nil
+}
+
+// Check returns a *PasswordPolicyError listing every failed rule, or nil.
+func (p *PasswordPolicy) Check(password string) error {
+	violations := []PolicyViolation{}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    "min_length",
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    "max_length",
+			Message: fmt.Sprintf("password must be at most %d characters", p.MaxLength),
+		})
+	}
+	breached, err := p.isBreached(password)
+	if err != nil {
+		return err
+	}
+	if breached {
+		violations = append(violations, PolicyViolation{
+			Rule:    "breached",
+			Message: "password has appeared in a data breach, choose another one",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+func (p *PasswordPolicy) isBreached(password string) (bool, error) {
+	if p.breached == nil {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	bucket, err := p.breached.bucket(digest[:sha1PrefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := bucket[digest[sha1PrefixLength:]]
+	return ok, nil
+}
+
+// breachedRanges reads range buckets from disk, keeping a bounded LRU
+// cache of the ones it has parsed.
+type breachedRanges struct {
+	dir string
+
+	mu      sync.Mutex
+	lru     *list.List
+	buckets map[string]*list.Element
+}
+
+type breachedBucket struct {
+	prefix   string
+	suffixes map[string]struct{}
+}
+
+func (b *breachedRanges) bucket(prefix string) (map[string]struct{}, error) {
+	b.mu.Lock()
+	if el, ok := b.buckets[prefix]; ok {
+		b.lru.MoveToFront(el)
+		b.mu.Unlock()
+		return el.Value.(*breachedBucket).suffixes, nil
+	}
+	b.mu.Unlock()
+
+	suffixes, err := b.read(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if el, ok := b.buckets[prefix]; ok {
+		b.lru.MoveToFront(el)
+		return el.Value.(*breachedBucket).suffixes, nil
+	}
+	b.buckets[prefix] = b.lru.PushFront(&breachedBucket{prefix: prefix, suffixes: suffixes})
+	if b.lru.Len() > breachedCacheSize {
+		oldest := b.lru.Remove(b.lru.Back()).(*breachedBucket)
+		delete(b.buckets, oldest.prefix)
+	}
+
+	return suffixes, nil
+}
+
+// read loads one bucket. A missing file means no breached password has
+// that prefix.
+func (b *breachedRanges) read(prefix string) (map[string]struct{}, error) {
+	for _, name := range []string{prefix, prefix + ".txt"} {
+		f, err := os.Open(filepath.Join(b.dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open breached passwords range %s: %v", prefix, err)
+		}
+		defer f.Close()
+
+		suffixes, err := parseRange(f)
+		if err != nil {
+			return nil, fmt.Errorf("breached passwords range %s: %v", prefix, err)
+		}
+
+		return suffixes, nil
+	}
+
+	return map[string]struct{}{}, nil
+}
+
+// parseRange reads SUFFIX:COUNT lines as served by the range API. Rows
+// with a zero count are padding and are skipped.
+func parseRange(r io.Reader) (map[string]struct{}, error) {
+	suffixes := map[string]struct{}{}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		suffix, count, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected SUFFIX:COUNT", line)
+		}
+		suffix = strings.ToUpper(suffix)
+		if len(suffix) != sha1.Size*2-sha1PrefixLength {
+			return nil, fmt.Errorf("line %d: expected a %d character suffix", line, sha1.Size*2-sha1PrefixLength)
+		}
+		if _, err := hex.DecodeString("0" + suffix); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("line %d: invalid count %q", line, count)
+		}
+		if n == 0 {
+			continue
+		}
+
+		suffixes[suffix] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return suffixes, nil
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	// Range buckets for "password" and "letmein123", as served by the
+	// range API: CRLF line endings, zero-count padding rows, and one
+	// bucket written with lowercase hex.
+	dir := t.TempDir()
+	writeRange(t, dir, "5BAA6", "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n"+
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"+
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD9:0\r\n")
+	writeRange(t, dir, "E2869.txt", "77b13f1a89e20d0459207545d15fe1eba08:42\n")
+
+	policy := NewPasswordPolicy(8, 64)
+	if err := policy.LoadBreachedPasswordsDir(dir); err != nil {
+		t.Fatalf("LoadBreachedPasswordsDir() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		password  string
+		wantRules []string
+	}{
+		{
+			name:      "Valid password",
+			password:  "correct horse battery",
+			wantRules: nil,
+		},
+		{
+			name:      "Too short",
+			password:  "abc",
+			wantRules: []string{"min_length"},
+		},
+		{
+			name:      "Multi-byte characters count once",
+			password:  "ééééééé",
+			wantRules: []string{"min_length"},
+		},
+		{
+			name:      "Too long",
+			password:  strings.Repeat("a", 65),
+			wantRules: []string{"max_length"},
+		},
+		{
+			name:      "Breached",
+			password:  "password",
+			wantRules: []string{"breached"},
+		},
+		{
+			name:      "Breached, lowercase suffix in range",
+			password:  "letmein123",
+			wantRules: []string{"breached"},
+		},
+		{
+			name:      "Empty",
+			password:  "",
+			wantRules: []string{"min_length"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password)
+			if tt.wantRules == nil {
+				if err != nil {
+					t.Errorf("Check() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Check() error = %v, want *PasswordPolicyError", err)
+			}
+
+			gotRules := []string{}
+			for _, v := range policyErr.Violations {
+				gotRules = append(gotRules, v.Rule)
+			}
+			if !reflect.DeepEqual(gotRules, tt.wantRules) {
+				t.Errorf("Check() rules = %v, want %v", gotRules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{
+			name:  "Counts and padding",
+			input: "003D68EB55068C33ACE09247EE4C639306B:3\r\n012C192B2F16F82EA0EB9EF18D9D539B0DD:0\r\n",
+			want:  1,
+		},
+		{
+			name:    "Full digest instead of suffix",
+			input:   "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\n",
+			wantErr: true,
+		},
+		{
+			name:    "Missing count",
+			input:   "003D68EB55068C33ACE09247EE4C639306B\n",
+			wantErr: true,
+		},
+		{
+			name:    "Not hex",
+			input:   "ZZZD68EB55068C33ACE09247EE4C639306B:3\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRange(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(got) != tt.want {
+				t.Errorf("parseRange() got %d suffixes, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestBreachedRangeErrors(t *testing.T) {
+	policy := NewPasswordPolicy(8, 64)
+	if err := policy.LoadBreachedPasswordsDir(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("LoadBreachedPasswordsDir() should reject a missing directory")
+	}
+
+	dir := t.TempDir()
+	writeRange(t, dir, "5BAA6", "not-a-range-line\n")
+	if err := policy.LoadBreachedPasswordsDir(dir); err != nil {
+		t.Fatalf("LoadBreachedPasswordsDir() error = %v", err)
+	}
+	var policyErr *PasswordPolicyError
+	if err := policy.Check("password"); err == nil || errors.As(err, &policyErr) {
+		t.Errorf("Check() error = %v, want a read error for a malformed range", err)
+	}
+}
+
+func writeRange(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
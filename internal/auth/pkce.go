@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+)
+
+// PKCE (RFC 7636) ties an authorization code to the client that asked
+// for it: the client sends the S256 challenge up front and has to prove
+// it knows the verifier when redeeming the code. Only S256 is supported.
+
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidatePKCEChallenge checks that challenge looks like an S256 digest.
+func ValidatePKCEChallenge(challenge string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(raw) != sha256.Size {
+		return errors.New("code_challenge must be a base64url encoded SHA-256 digest")
+	}
+
+	return nil
+}
+
+// VerifyPKCE reports whether verifier is well formed and hashes to
+// challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
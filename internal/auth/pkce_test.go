@@ -0,0 +1,85 @@
+package auth
+
+import "testing"
+
+func TestVerifyPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Fatalf("PKCEChallenge() = %q, want %q", got, challenge)
+	}
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{
+			name:      "Matching verifier",
+			verifier:  verifier,
+			challenge: challenge,
+			want:      true,
+		},
+		{
+			name:      "Wrong verifier",
+			verifier:  "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXx",
+			challenge: challenge,
+			want:      false,
+		},
+		{
+			name:      "Verifier too short",
+			verifier:  "short",
+			challenge: PKCEChallenge("short"),
+			want:      false,
+		},
+		{
+			name:      "Verifier with invalid characters",
+			verifier:  "dBjftJeZ4CVP+mB92K27uhbUJU1p1r/wW1gFWFOEjXk",
+			challenge: PKCEChallenge("dBjftJeZ4CVP+mB92K27uhbUJU1p1r/wW1gFWFOEjXk"),
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePKCEChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		wantErr   bool
+	}{
+		{
+			name:      "S256 challenge",
+			challenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+			wantErr:   false,
+		},
+		{
+			name:      "Plain verifier",
+			challenge: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk-extra",
+			wantErr:   true,
+		},
+		{
+			name:      "Empty",
+			challenge: "",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePKCEChallenge(tt.challenge); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePKCEChallenge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes limit what a delegated credential such as an API key may do on
+// the user's behalf.
+const (
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var knownScopes = []string{ScopeChirpsWrite, ScopeProfileWrite}
+
+// ValidateScopes checks that every scope is known and returns them
+// sorted without duplicates.
+func ValidateScopes(scopes []string) ([]string, error) {
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(knownScopes, scope) {
+			return nil, fmt.Errorf("unknown scope: %q", scope)
+		}
+		out = append(out, scope)
+	}
+
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// ParseScopes splits a space separated scope string as used by OAuth2.
+func ParseScopes(s string) ([]string, error) {
+	return ValidateScopes(strings.Fields(s))
+}
+
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, scope)
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "Single scope",
+			input: "chirps:write",
+			want:  []string{ScopeChirpsWrite},
+		},
+		{
+			name:  "Deduplicated",
+			input: "chirps:write  chirps:write",
+			want:  []string{ScopeChirpsWrite},
+		},
+		{
+			name:  "Sorted",
+			input: "profile:write chirps:write",
+			want:  []string{ScopeChirpsWrite, ScopeProfileWrite},
+		},
+		{
+			name:  "Empty",
+			input: "",
+			want:  []string{},
+		},
+		{
+			name:    "Unknown scope",
+			input:   "chirps:write admin",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScopes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("ParseScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,17 +2,16 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
 )
 
+const apiKeyPrefix = "chirpy_"
+
 func GetBearerToken(headers http.Header) (string, error) {
 	tokenString := headers.Get("Authorization")
 	if tokenString == "" {
@@ -27,6 +26,20 @@ func GetBearerToken(headers http.Header) (string, error) {
 	return token[1], nil
 }
 
+func GetAPIKey(headers http.Header) (string, error) {
+	keyString := headers.Get("Authorization")
+	if keyString == "" {
+		return keyString, errors.New("auth header empty, no api key found")
+	}
+
+	key := strings.Fields(keyString)
+	if len(key) != 2 || key[0] != "ApiKey" || key[1] == "" {
+		return "", errors.New("wrong api key")
+	}
+
+	return key[1], nil
+}
+
 func MakeRefreshToken() (string, error) {
 	key := make([]byte, 32)
 	_, err := rand.Read(key)
@@ -38,39 +51,20 @@ func MakeRefreshToken() (string, error) {
 	return encodedStr, nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy-access",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn * time.Hour)),
-		Subject:   userID.String(),
-	})
-
-	ss, err := token.SignedString([]byte(tokenSecret))
+// MakeAPIKey returns a new personal API key. The fixed prefix makes
+// leaked keys easy to spot in logs and secret scanners.
+func MakeAPIKey() (string, error) {
+	key, err := MakeRefreshToken()
 	if err != nil {
-		return "", fmt.Errorf("issue signing token: %v", err)
+		return "", err
 	}
 
-	return ss, nil
+	return apiKeyPrefix + key, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(tokenSecret), nil
-	})
-
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("couldn't parse the token string: %v", err)
-	} else if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok {
-		if id, err := uuid.Parse(claims.Subject); err != nil {
-			return uuid.Nil, fmt.Errorf("unable to parse user_id: %v", err)
-		} else {
-			return id, nil
-		}
-	} else {
-		return uuid.Nil, errors.New("wrong claims")
-	}
+// HashToken returns the hex SHA-256 digest of an opaque token so it can
+// be stored and looked up without keeping the token itself at rest.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
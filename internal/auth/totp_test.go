@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B vectors for SHA-1, truncated to 6 digits.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current, _ := TOTPCode(rfcSecret, now)
+	previous, _ := TOTPCode(rfcSecret, now.Add(-30*time.Second))
+	stale, _ := TOTPCode(rfcSecret, now.Add(-90*time.Second))
+
+	tests := []struct {
+		name   string
+		code   string
+		wantOK bool
+	}{
+		{name: "Current code", code: current, wantOK: true},
+		{name: "Previous step within skew", code: previous, wantOK: true},
+		{name: "Code outside skew", code: stale, wantOK: false},
+		{name: "Wrong length", code: "123", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := ValidateTOTP(rfcSecret, tt.code, now)
+			if ok != tt.wantOK {
+				t.Errorf("ValidateTOTP() = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected recovery code format: %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code: %q", code)
+		}
+		seen[code] = true
+
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+		if NormalizeRecoveryCode(typed) != code {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", typed, NormalizeRecoveryCode(typed), code)
+		}
+	}
+}
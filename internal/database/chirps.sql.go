@@ -7,6 +7,8 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -15,18 +17,25 @@ const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (
     id,
     body,
-    user_id
-) VALUES ( $1, $2, $3 ) RETURNING id, created_at, updated_at, body, user_id
+    user_id,
+    in_reply_to
+) VALUES ( $1, $2, $3, $4 ) RETURNING id, created_at, updated_at, body, user_id, in_reply_to
 `
 
 type CreateChirpParams struct {
-	ID     uuid.UUID
-	Body   string
-	UserID uuid.UUID
+	ID        uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.ID, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.ID,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -34,6 +43,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
 	)
 	return i, err
 }
@@ -57,7 +67,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, arg DeleteChirpParams) (int64
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, in_reply_to FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -69,19 +79,318 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
+const listChirpAncestors = `-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.in_reply_to, 1 AS depth
+        FROM chirps AS child
+        JOIN chirps AS parent ON parent.id = child.in_reply_to
+        WHERE child.id = $1
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, ancestors.depth + 1
+        FROM chirps
+        JOIN ancestors ON chirps.id = ancestors.in_reply_to
+        WHERE ancestors.depth < $2::integer
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to
+    FROM ancestors
+    ORDER BY depth DESC
+`
+
+type ListChirpAncestorsParams struct {
+	ChirpID  uuid.UUID
+	MaxDepth int32
+}
+
+type ListChirpAncestorsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+}
+
+func (q *Queries) ListChirpAncestors(ctx context.Context, arg ListChirpAncestorsParams) ([]ListChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAncestors, arg.ChirpID, arg.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpAncestorsRow
+	for rows.Next() {
+		var i ListChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpDescendants = `-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    (SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, 1 AS depth
+        FROM chirps
+        WHERE chirps.in_reply_to = $1
+        ORDER BY chirps.created_at ASC, chirps.id ASC
+        LIMIT $2)
+    UNION ALL
+    SELECT replies.id, replies.created_at, replies.updated_at, replies.body, replies.user_id, replies.in_reply_to, descendants.depth + 1
+        FROM descendants
+        CROSS JOIN LATERAL (
+            SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to
+                FROM chirps
+                WHERE chirps.in_reply_to = descendants.id
+                ORDER BY chirps.created_at ASC, chirps.id ASC
+                LIMIT $2
+        ) replies
+        WHERE descendants.depth < $3::integer
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to
+    FROM (
+        SELECT id, created_at, updated_at, body, user_id, in_reply_to
+            FROM descendants
+            LIMIT $2
+    ) bounded
+    ORDER BY created_at ASC, id ASC
+`
+
+type ListChirpDescendantsParams struct {
+	ChirpID  uuid.UUID
+	Limit    int32
+	MaxDepth int32
+}
+
+type ListChirpDescendantsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+}
+
+// Each chirp contributes at most limit replies, and the walk, which goes
+// level by level, stops after limit rows, so a huge subtree is never
+// expanded in full before sorting.
+func (q *Queries) ListChirpDescendants(ctx context.Context, arg ListChirpDescendantsParams) ([]ListChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendants, arg.ChirpID, arg.Limit, arg.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpDescendantsRow
+	for rows.Next() {
+		var i ListChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpReplies = `-- name: ListChirpReplies :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to
     FROM chirps
-    ORDER BY updated_at
-    LIMIT $1
+    WHERE in_reply_to = $1
+    AND (
+        $2::timestamp IS NULL
+        OR (created_at, id) > ($2::timestamp, $3::uuid)
+    )
+    ORDER BY created_at ASC, id ASC
+    LIMIT $4
+`
+
+type ListChirpRepliesParams struct {
+	ChirpID        uuid.UUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpReplies(ctx context.Context, arg ListChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpReplies,
+		arg.ChirpID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to
+    FROM chirps
+    WHERE ($1::uuid IS NULL OR user_id = $1)
+    AND (
+        $2::timestamp IS NULL
+        OR (created_at, id) > ($2::timestamp, $3::uuid)
+    )
+    ORDER BY created_at ASC, id ASC
+    LIMIT $4
+`
+
+type ListChirpsAscParams struct {
+	AuthorID       uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to
+    FROM chirps
+    WHERE ($1::uuid IS NULL OR user_id = $1)
+    AND (
+        $2::timestamp IS NULL
+        OR (created_at, id) < ($2::timestamp, $3::uuid)
+    )
+    ORDER BY created_at DESC, id DESC
+    LIMIT $4
+`
+
+type ListChirpsDescParams struct {
+	AuthorID       uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserChirps = `-- name: ListUserChirps :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to FROM chirps
+    WHERE user_id = $1
+    ORDER BY created_at ASC, id ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context, limit int32) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps, limit)
+func (q *Queries) ListUserChirps(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listUserChirps, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -95,6 +404,7 @@ func (q *Queries) GetChirps(ctx context.Context, limit int32) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
 		); err != nil {
 			return nil, err
 		}
@@ -7,46 +7,89 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+UPDATE users
+    SET delete_after = NULL, updated_at = NOW()
+    WHERE id = $1 AND delete_after IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
     id,
     email,
-    password
-) VALUES ( $1, $2, $3 ) RETURNING id, email, created_at, updated_at
+    password,
+    handle
+) VALUES ( $1, $2, $3, $4 ) RETURNING id, email, created_at, updated_at, is_chirpy_red, role, handle
 `
 
 type CreateUserParams struct {
 	ID       uuid.UUID
 	Email    string
 	Password string
+	Handle   string
 }
 
 type CreateUserRow struct {
-	ID        uuid.UUID
-	Email     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          uuid.UUID
+	Email       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	IsChirpyRed bool
+	Role        string
+	Handle      string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.ID, arg.Email, arg.Password)
+	row := q.db.QueryRowContext(ctx, createUser,
+		arg.ID,
+		arg.Email,
+		arg.Password,
+		arg.Handle,
+	)
 	var i CreateUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.Email,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Handle,
 	)
 	return i, err
 }
 
+const enableUserTOTP = `-- name: EnableUserTOTP :execrows
+UPDATE users
+    SET totp_enabled_at = NOW(), updated_at = NOW()
+    WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+`
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enableUserTOTP, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, password
+SELECT id, created_at, updated_at, email, password, is_chirpy_red, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, role, delete_after, handle, display_name, bio, avatar_url
     FROM users
     WHERE email = $1
 `
@@ -60,23 +103,467 @@ func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, password, is_chirpy_red, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, role, delete_after, handle, display_name, bio, avatar_url
+    FROM users
+    WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.Password,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+	)
+	return i, err
+}
+
+const getUserDeleteAfter = `-- name: GetUserDeleteAfter :one
+SELECT delete_after FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserDeleteAfter(ctx context.Context, id uuid.UUID) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, getUserDeleteAfter, id)
+	var delete_after sql.NullTime
+	err := row.Scan(&delete_after)
+	return delete_after, err
+}
+
+const getUserProfile = `-- name: GetUserProfile :one
+SELECT id, created_at, handle, display_name, bio, avatar_url, is_chirpy_red
+    FROM users
+    WHERE id = $1
+`
+
+type GetUserProfileRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
+	IsChirpyRed bool
+}
+
+func (q *Queries) GetUserProfile(ctx context.Context, id uuid.UUID) (GetUserProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfile, id)
+	var i GetUserProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsChirpyRed,
+	)
+	return i, err
+}
+
+const getUserProfileByHandle = `-- name: GetUserProfileByHandle :one
+SELECT id, created_at, handle, display_name, bio, avatar_url, is_chirpy_red
+    FROM users
+    WHERE handle = $1
+`
+
+type GetUserProfileByHandleRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
+	IsChirpyRed bool
+}
+
+func (q *Queries) GetUserProfileByHandle(ctx context.Context, handle string) (GetUserProfileByHandleRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfileByHandle, handle)
+	var i GetUserProfileByHandleRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsChirpyRed,
+	)
+	return i, err
+}
+
+const listChirpAuthors = `-- name: ListChirpAuthors :many
+SELECT id, handle, display_name, avatar_url
+    FROM users
+    WHERE id = ANY($1::uuid[])
+`
+
+type ListChirpAuthorsRow struct {
+	ID          uuid.UUID
+	Handle      string
+	DisplayName string
+	AvatarUrl   string
+}
+
+func (q *Queries) ListChirpAuthors(ctx context.Context, ids []uuid.UUID) ([]ListChirpAuthorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAuthors, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpAuthorsRow
+	for rows.Next() {
+		var i ListChirpAuthorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Handle,
+			&i.DisplayName,
+			&i.AvatarUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const patchUser = `-- name: PatchUser :one
+UPDATE users
+    SET password = COALESCE($1, password),
+        pending_email = CASE WHEN $2::boolean THEN $3 ELSE pending_email END,
+        handle = COALESCE($4, handle),
+        display_name = COALESCE($5, display_name),
+        bio = COALESCE($6, bio),
+        avatar_url = COALESCE($7, avatar_url),
+        updated_at = NOW()
+    WHERE id = $8
+    RETURNING id, created_at, updated_at, email, password, is_chirpy_red, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, role, delete_after, handle, display_name, bio, avatar_url
+`
+
+type PatchUserParams struct {
+	Password        sql.NullString
+	SetPendingEmail bool
+	PendingEmail    sql.NullString
+	Handle          sql.NullString
+	DisplayName     sql.NullString
+	Bio             sql.NullString
+	AvatarUrl       sql.NullString
+	ID              uuid.UUID
+}
+
+func (q *Queries) PatchUser(ctx context.Context, arg PatchUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, patchUser,
+		arg.Password,
+		arg.SetPendingEmail,
+		arg.PendingEmail,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.Password,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
 	)
 	return i, err
 }
 
-const updateUserPassword = `-- name: UpdateUserPassword :exec
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+    WHERE delete_after IS NOT NULL AND delete_after <= NOW()
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const recordUserTOTPStep = `-- name: RecordUserTOTPStep :execrows
+UPDATE users
+    SET totp_last_step = $2
+    WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+`
+
+type RecordUserTOTPStepParams struct {
+	ID           uuid.UUID
+	TotpLastStep sql.NullInt64
+}
+
+func (q *Queries) RecordUserTOTPStep(ctx context.Context, arg RecordUserTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, recordUserTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :execrows
 UPDATE users
-    SET password = $2, email = $3
+    SET password = $1
+    WHERE id = $2 AND password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewPassword string
+	ID          uuid.UUID
+	OldPassword string
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewPassword, arg.ID, arg.OldPassword)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+    SET delete_after = COALESCE(delete_after, $1::timestamp), updated_at = NOW()
+    WHERE id = $2
+    RETURNING delete_after
+`
+
+type ScheduleUserDeletionParams struct {
+	DeleteAfter time.Time
+	ID          uuid.UUID
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.DeleteAfter, arg.ID)
+	var delete_after sql.NullTime
+	err := row.Scan(&delete_after)
+	return delete_after, err
+}
+
+const setUserPassword = `-- name: SetUserPassword :exec
+UPDATE users
+    SET password = $2, updated_at = NOW()
     WHERE id = $1
 `
 
-type UpdateUserPasswordParams struct {
+type SetUserPasswordParams struct {
 	ID       uuid.UUID
 	Password string
-	Email    string
 }
 
-func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
-	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.Password, arg.Email)
+func (q *Queries) SetUserPassword(ctx context.Context, arg SetUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPassword, arg.ID, arg.Password)
 	return err
 }
+
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE users
+    SET role = $2, updated_at = NOW()
+    WHERE id = $1
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :execrows
+UPDATE users
+    SET totp_secret = $2, updated_at = NOW()
+    WHERE id = $1 AND totp_enabled_at IS NULL
+`
+
+type SetUserTOTPSecretParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserTOTPSecret, arg.ID, arg.TotpSecret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users
+    SET password = $2, pending_email = $3, updated_at = NOW()
+    WHERE id = $1
+    RETURNING id, created_at, updated_at, email, is_chirpy_red, email_verified_at, pending_email, role, handle
+`
+
+type UpdateUserPasswordParams struct {
+	ID           uuid.UUID
+	Password     string
+	PendingEmail sql.NullString
+}
+
+type UpdateUserPasswordRow struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	IsChirpyRed     bool
+	EmailVerifiedAt sql.NullTime
+	PendingEmail    sql.NullString
+	Role            string
+	Handle          string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (UpdateUserPasswordRow, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.ID, arg.Password, arg.PendingEmail)
+	var i UpdateUserPasswordRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+    SET handle = $2, display_name = $3, bio = $4, avatar_url = $5, updated_at = NOW()
+    WHERE id = $1
+    RETURNING id, created_at, handle, display_name, bio, avatar_url, is_chirpy_red
+`
+
+type UpdateUserProfileParams struct {
+	ID          uuid.UUID
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
+}
+
+type UpdateUserProfileRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
+	IsChirpyRed bool
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (UpdateUserProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.ID,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+	)
+	var i UpdateUserProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsChirpyRed,
+	)
+	return i, err
+}
+
+const upgradeUserToChirpyRed = `-- name: UpgradeUserToChirpyRed :execrows
+UPDATE users
+    SET is_chirpy_red = TRUE, updated_at = NOW()
+    WHERE id = $1
+`
+
+func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, upgradeUserToChirpyRed, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :execrows
+UPDATE users
+    SET email = $2, pending_email = NULL, email_verified_at = NOW(), updated_at = NOW()
+    WHERE id = $1 AND (email = $2 OR pending_email = $2)
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,181 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	m := &MemoryMailer{}
+
+	tests := []struct {
+		name    string
+		msg     Message
+		wantErr bool
+	}{
+		{
+			name:    "Valid message",
+			msg:     Message{To: "user@example.com", Subject: "Hello", Body: "Hi there"},
+			wantErr: false,
+		},
+		{
+			name:    "Header injection in subject",
+			msg:     Message{To: "user@example.com", Subject: "Hello\r\nBcc: evil@example.com", Body: "Hi"},
+			wantErr: true,
+		},
+		{
+			name:    "Header injection in recipient",
+			msg:     Message{To: "user@example.com\nBcc: evil@example.com", Subject: "Hello", Body: "Hi"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := m.Send(context.Background(), tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := m.Messages(); len(got) != 1 || got[0].To != "user@example.com" {
+		t.Errorf("Messages() = %+v, want the one valid message", got)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFileMailer(dir, "chirpy@example.com")
+
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 mail file, got %d", len(entries))
+	}
+
+	data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	for _, want := range []string{"From: chirpy@example.com\r\n", "To: user@example.com\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("mail file missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestSMTPMailerDeadline(t *testing.T) {
+	// A relay that accepts the connection but never sends its greeting.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	m, err := NewSMTPMailer(host, port, "", "", "chirpy@example.com")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = m.Send(ctx, Message{To: "user@example.com", Subject: "Hello", Body: "Hi"})
+	if err == nil {
+		t.Fatal("Send() succeeded against a stalled relay")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send() took %v, want it bounded by the context deadline", elapsed)
+	}
+}
+
+func TestSMTPMailerEnvelope(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+
+	// A minimal relay that records the commands it receives.
+	commands := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var got []string
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if inData {
+				if line == "." {
+					inData = false
+					fmt.Fprint(conn, "250 OK\r\n")
+				}
+				continue
+			}
+			got = append(got, line)
+			switch {
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				fmt.Fprint(conn, "354 Go ahead\r\n")
+			case strings.HasPrefix(line, "QUIT"):
+				fmt.Fprint(conn, "221 Bye\r\n")
+				commands <- got
+				return
+			default:
+				fmt.Fprint(conn, "250 OK\r\n")
+			}
+		}
+		commands <- got
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	m, err := NewSMTPMailer(host, port, "", "", "Chirpy <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+
+	if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "Hi"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	got := <-commands
+	if !slices.Contains(got, "MAIL FROM:<no-reply@example.com>") {
+		t.Errorf("relay got %q, want the bare sender address in MAIL FROM", got)
+	}
+}
+
+func TestNewSMTPMailerRejectsBadFrom(t *testing.T) {
+	if _, err := NewSMTPMailer("localhost", "25", "", "", "not an address"); err == nil {
+		t.Errorf("NewSMTPMailer() should reject a malformed from address")
+	}
+}
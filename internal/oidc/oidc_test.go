@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a minimal OpenID provider that hands out whatever ID
+// token claims the test sets.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	code   string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	m := &mockIssuer{key: key, code: "good-code"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" || r.FormValue("code") != m.code {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		token.Header["kid"] = "test-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"id_token":     signed,
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	return m
+}
+
+func (m *mockIssuer) validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            "client",
+		"sub":            "external-user",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "nonce",
+		"email":          "user@example.com",
+		"email_verified": true,
+	}
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	provider := NewProvider(Config{
+		Issuer:       m.server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/oidc/callback",
+	}, m.server.Client())
+
+	tests := []struct {
+		name    string
+		claims  func(jwt.MapClaims)
+		code    string
+		nonce   string
+		wantErr bool
+	}{
+		{
+			name:    "Valid id token",
+			claims:  func(jwt.MapClaims) {},
+			code:    "good-code",
+			nonce:   "nonce",
+			wantErr: false,
+		},
+		{
+			name:    "Wrong code",
+			claims:  func(jwt.MapClaims) {},
+			code:    "bad-code",
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "Nonce mismatch",
+			claims:  func(jwt.MapClaims) {},
+			code:    "good-code",
+			nonce:   "other-nonce",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong audience",
+			claims:  func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+			code:    "good-code",
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong issuer",
+			claims:  func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			code:    "good-code",
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "Expired",
+			claims:  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+			code:    "good-code",
+			nonce:   "nonce",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.claims = m.validClaims()
+			tt.claims(m.claims)
+
+			identity, err := provider.Exchange(context.Background(), tt.code, "verifier", tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exchange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			want := Identity{
+				Issuer:        m.server.URL,
+				Subject:       "external-user",
+				Email:         "user@example.com",
+				EmailVerified: true,
+			}
+			if identity != want {
+				t.Errorf("Exchange() = %+v, want %+v", identity, want)
+			}
+		})
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	m := newMockIssuer(t)
+	provider := NewProvider(Config{
+		Issuer:      m.server.URL,
+		ClientID:    "client",
+		RedirectURL: "http://localhost:8080/api/oidc/callback",
+	}, m.server.Client())
+
+	raw, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+
+	if !strings.HasPrefix(raw, m.server.URL+"/authorize?") {
+		t.Fatalf("AuthCodeURL() = %q, want the authorization endpoint", raw)
+	}
+
+	u, _ := url.Parse(raw)
+	for key, want := range map[string]string{
+		"client_id":             "client",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+		"response_type":         "code",
+	} {
+		if got := u.Query().Get(key); got != want {
+			t.Errorf("AuthCodeURL() %s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockIssuer(t)
+	// The trailing slash still finds the discovery document, but the
+	// issuer it names is no longer an exact match.
+	provider := NewProvider(Config{
+		Issuer:   m.server.URL + "/",
+		ClientID: "client",
+	}, m.server.Client())
+
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Errorf("AuthCodeURL() accepted a discovery document for another issuer")
+	}
+}
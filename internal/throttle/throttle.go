@@ -0,0 +1,165 @@
+// Package throttle contains the functionality
+// for slowing down repeated failed logins
+package throttle
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Policy decides how long a key is locked out after a number of
+// consecutive failures. Lockouts double with every failure past
+// FreeAttempts, up to MaxLockout. Failures older than Window are
+// forgotten.
+type Policy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	Window       time.Duration
+}
+
+func (p Policy) Lockout(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	lockout := p.BaseLockout
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		lockout *= 2
+		if lockout >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+
+	return min(lockout, p.MaxLockout)
+}
+
+// lockouts lists Lockout in seconds for one failure, two failures and so
+// on, up to the first count that reaches MaxLockout; later counts reuse
+// the last entry. Passing the list lets the database apply the policy
+// in the same statement that counts the attempt.
+func (p Policy) lockouts() []int32 {
+	lockouts := []int32{}
+	for failures := 1; ; failures++ {
+		lockout := p.Lockout(failures)
+		lockouts = append(lockouts, seconds(lockout))
+		if failures > p.FreeAttempts && (lockout == 0 || lockout >= p.MaxLockout) {
+			return lockouts
+		}
+	}
+}
+
+var (
+	// Accounts lock quickly; a single address gets more room since many
+	// users can share one behind NAT.
+	AccountPolicy = Policy{
+		FreeAttempts: 5,
+		BaseLockout:  30 * time.Second,
+		MaxLockout:   time.Hour,
+		Window:       time.Hour,
+	}
+	IPPolicy = Policy{
+		FreeAttempts: 20,
+		BaseLockout:  10 * time.Second,
+		MaxLockout:   15 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
+// Key identifies what is being throttled together with its policy.
+type Key struct {
+	id     string
+	policy Policy
+}
+
+func EmailKey(email string) Key {
+	return Key{id: "email:" + strings.ToLower(strings.TrimSpace(email)), policy: AccountPolicy}
+}
+
+func IPKey(ip string) Key {
+	return Key{id: "ip:" + ip, policy: IPPolicy}
+}
+
+// SecondFactorKey throttles TOTP and recovery code guesses for a user.
+func SecondFactorKey(userID uuid.UUID) Key {
+	return Key{id: "mfa:" + userID.String(), policy: AccountPolicy}
+}
+
+// Throttler keeps its counters in Postgres so limits hold across every
+// server instance.
+type Throttler struct {
+	db *database.Queries
+}
+
+func New(db *database.Queries) *Throttler {
+	return &Throttler{db: db}
+}
+
+// Reserve counts an attempt against every key before it is checked and
+// locks the keys as if it will fail, so a burst of concurrent guesses is
+// held to the same limit as sequential ones. It returns how long the
+// caller must wait if any key is already locked, in which case nothing
+// is counted. Callers Reset or Release keys once the attempt succeeds.
+func (t *Throttler) Reserve(ctx context.Context, keys ...Key) (time.Duration, error) {
+	var retryAfter time.Duration
+	reserved := make([]Key, 0, len(keys))
+	for _, key := range keys {
+		row, err := t.db.ReserveLoginAttempt(ctx, database.ReserveLoginAttemptParams{
+			Key:           key.id,
+			Lockouts:      key.policy.lockouts(),
+			WindowSeconds: seconds(key.policy.Window),
+		})
+		if err != nil {
+			return 0, err
+		}
+		if row.Reserved {
+			reserved = append(reserved, key)
+			continue
+		}
+		retryAfter = max(retryAfter, time.Duration(row.RetryAfter)*time.Second)
+	}
+
+	if retryAfter > 0 {
+		if err := t.Release(ctx, reserved...); err != nil {
+			return 0, err
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// Release takes back an attempt reserved against keys without forgetting
+// earlier failures, for keys that a success shouldn't reset.
+func (t *Throttler) Release(ctx context.Context, keys ...Key) error {
+	for _, key := range keys {
+		err := t.db.ReleaseLoginAttempt(ctx, database.ReleaseLoginAttemptParams{
+			FreeAttempts: int32(key.policy.FreeAttempts),
+			Key:          key.id,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reset forgets past failures for keys after a successful attempt.
+func (t *Throttler) Reset(ctx context.Context, keys ...Key) error {
+	for _, key := range keys {
+		if err := t.db.ClearLoginAttempts(ctx, key.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func seconds(d time.Duration) int32 {
+	return int32(min(math.Ceil(d.Seconds()), math.MaxInt32))
+}
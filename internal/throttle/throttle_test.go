@@ -0,0 +1,75 @@
+package throttle
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPolicyLockout(t *testing.T) {
+	policy := Policy{
+		FreeAttempts: 3,
+		BaseLockout:  time.Second,
+		MaxLockout:   10 * time.Second,
+	}
+
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{name: "No failures", failures: 0, want: 0},
+		{name: "Within free attempts", failures: 3, want: 0},
+		{name: "First lockout", failures: 4, want: time.Second},
+		{name: "Doubles", failures: 5, want: 2 * time.Second},
+		{name: "Doubles again", failures: 7, want: 8 * time.Second},
+		{name: "Capped", failures: 8, want: 10 * time.Second},
+		{name: "Stays capped", failures: 500, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Lockout(tt.failures); got != tt.want {
+				t.Errorf("Lockout(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyLockouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []int32
+	}{
+		{
+			name:   "Doubles up to the cap",
+			policy: Policy{FreeAttempts: 2, BaseLockout: time.Second, MaxLockout: 5 * time.Second},
+			want:   []int32{0, 0, 1, 2, 4, 5},
+		},
+		{
+			name:   "Rounds up to whole seconds",
+			policy: Policy{FreeAttempts: 1, BaseLockout: 1500 * time.Millisecond, MaxLockout: 2 * time.Second},
+			want:   []int32{0, 2, 2},
+		},
+		{
+			name:   "Never locks",
+			policy: Policy{FreeAttempts: 1},
+			want:   []int32{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.lockouts(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lockouts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailKeyNormalizes(t *testing.T) {
+	if EmailKey(" User@Example.com ") != EmailKey("user@example.com") {
+		t.Errorf("EmailKey() should ignore case and surrounding spaces")
+	}
+}
@@ -0,0 +1,138 @@
+// Package timeline keeps users' home timelines materialized: every chirp
+// is copied into the timeline of each follower of its author when it is
+// posted, so reading a timeline never has to join follows with chirps.
+package timeline
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// BackfillLimit is how many of an author's most recent chirps are
+	// copied into a new follower's timeline.
+	BackfillLimit = 200
+
+	// A queued chirp that hasn't been fanned out after staleAfter is
+	// assumed lost, e.g. to a full queue or a restart, and queued again.
+	staleAfter    = time.Minute
+	sweepInterval = time.Minute
+	sweepBatch    = 500
+)
+
+// Store is the subset of database queries the fan-out needs.
+type Store interface {
+	FanOutChirp(ctx context.Context, chirpID uuid.UUID) (int64, error)
+	ListStaleFanouts(ctx context.Context, arg database.ListStaleFanoutsParams) ([]uuid.UUID, error)
+	BackfillTimeline(ctx context.Context, arg database.BackfillTimelineParams) (int64, error)
+	DeleteTimelineAuthorEntries(ctx context.Context, arg database.DeleteTimelineAuthorEntriesParams) (int64, error)
+}
+
+// Fanout copies new chirps into followers' timelines in the background.
+// Chirps are durably queued in the database before they are published,
+// so a chirp dropped from the in-memory queue is picked up by the next
+// sweep; copying is idempotent, so a chirp fanned out twice is harmless.
+type Fanout struct {
+	store   Store
+	queue   chan uuid.UUID
+	workers int
+}
+
+func New(store Store, workers, queueSize int) *Fanout {
+	return &Fanout{
+		store:   store,
+		queue:   make(chan uuid.UUID, queueSize),
+		workers: max(workers, 1),
+	}
+}
+
+// Publish schedules a chirp for fan-out. It never blocks; when the queue
+// is full the chirp waits for the next sweep instead.
+func (f *Fanout) Publish(chirpID uuid.UUID) {
+	select {
+	case f.queue <- chirpID:
+	default:
+	}
+}
+
+// Run fans out published chirps until ctx is done.
+func (f *Fanout) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range f.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.work(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+			f.sweep(ctx)
+		}
+	}
+}
+
+func (f *Fanout) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case chirpID := <-f.queue:
+			if _, err := f.store.FanOutChirp(ctx, chirpID); err != nil {
+				log.Printf("couldn't fan out chirp %s: %v", chirpID, err)
+			}
+		}
+	}
+}
+
+// sweep queues chirps that have been waiting too long.
+func (f *Fanout) sweep(ctx context.Context) {
+	chirpIDs, err := f.store.ListStaleFanouts(ctx, database.ListStaleFanoutsParams{
+		Before: time.Now().Add(-staleAfter),
+		Limit:  sweepBatch,
+	})
+	if err != nil {
+		log.Printf("couldn't list stale fan-outs: %v", err)
+		return
+	}
+
+	for _, chirpID := range chirpIDs {
+		select {
+		case f.queue <- chirpID:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Follow copies the author's recent chirps into the follower's timeline.
+func (f *Fanout) Follow(ctx context.Context, followerID, authorID uuid.UUID) error {
+	_, err := f.store.BackfillTimeline(ctx, database.BackfillTimelineParams{
+		UserID:   followerID,
+		AuthorID: authorID,
+		Limit:    BackfillLimit,
+	})
+	return err
+}
+
+// Unfollow removes the author's chirps from the follower's timeline.
+func (f *Fanout) Unfollow(ctx context.Context, followerID, authorID uuid.UUID) error {
+	_, err := f.store.DeleteTimelineAuthorEntries(ctx, database.DeleteTimelineAuthorEntriesParams{
+		UserID:   followerID,
+		AuthorID: authorID,
+	})
+	return err
+}
@@ -0,0 +1,143 @@
+package timeline
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deexth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	mu        sync.Mutex
+	fannedOut []uuid.UUID
+	stale     []uuid.UUID
+	backfill  database.BackfillTimelineParams
+	deleted   database.DeleteTimelineAuthorEntriesParams
+}
+
+func (s *fakeStore) FanOutChirp(ctx context.Context, chirpID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fannedOut = append(s.fannedOut, chirpID)
+	return 1, nil
+}
+
+func (s *fakeStore) ListStaleFanouts(ctx context.Context, arg database.ListStaleFanoutsParams) ([]uuid.UUID, error) {
+	return s.stale, nil
+}
+
+func (s *fakeStore) BackfillTimeline(ctx context.Context, arg database.BackfillTimelineParams) (int64, error) {
+	s.backfill = arg
+	return 0, nil
+}
+
+func (s *fakeStore) DeleteTimelineAuthorEntries(ctx context.Context, arg database.DeleteTimelineAuthorEntriesParams) (int64, error) {
+	s.deleted = arg
+	return 0, nil
+}
+
+func (s *fakeStore) waitFor(t *testing.T, n int) []uuid.UUID {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		got := append([]uuid.UUID(nil), s.fannedOut...)
+		s.mu.Unlock()
+		if len(got) >= n {
+			return got
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %d fan-outs", n)
+	return nil
+}
+
+func TestPublishFansOut(t *testing.T) {
+	store := &fakeStore{}
+	fanout := New(store, 2, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		fanout.Run(ctx)
+		close(done)
+	}()
+
+	chirpID := uuid.New()
+	fanout.Publish(chirpID)
+
+	got := store.waitFor(t, 1)
+	if got[0] != chirpID {
+		t.Errorf("FanOutChirp() called with %v, want %v", got[0], chirpID)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Run() didn't return after its context was cancelled")
+	}
+}
+
+func TestPublishDoesNotBlockWhenFull(t *testing.T) {
+	fanout := New(&fakeStore{}, 1, 1)
+
+	returned := make(chan struct{})
+	go func() {
+		fanout.Publish(uuid.New())
+		fanout.Publish(uuid.New())
+		close(returned)
+	}()
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatalf("Publish() blocked on a full queue")
+	}
+}
+
+func TestSweepQueuesStaleFanouts(t *testing.T) {
+	stale := []uuid.UUID{uuid.New(), uuid.New()}
+	store := &fakeStore{stale: stale}
+	fanout := New(store, 1, 10)
+
+	fanout.sweep(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fanout.work(ctx)
+
+	got := store.waitFor(t, len(stale))
+	for i := range stale {
+		if got[i] != stale[i] {
+			t.Errorf("fan-out %d = %v, want %v", i, got[i], stale[i])
+		}
+	}
+}
+
+func TestFollowAndUnfollow(t *testing.T) {
+	store := &fakeStore{}
+	fanout := New(store, 1, 1)
+	follower, author := uuid.New(), uuid.New()
+
+	if err := fanout.Follow(context.Background(), follower, author); err != nil {
+		t.Fatalf("Follow() error = %v", err)
+	}
+	want := database.BackfillTimelineParams{UserID: follower, AuthorID: author, Limit: BackfillLimit}
+	if store.backfill != want {
+		t.Errorf("Follow() backfilled %+v, want %+v", store.backfill, want)
+	}
+
+	if err := fanout.Unfollow(context.Background(), follower, author); err != nil {
+		t.Fatalf("Unfollow() error = %v", err)
+	}
+	wantDeleted := database.DeleteTimelineAuthorEntriesParams{UserID: follower, AuthorID: author}
+	if store.deleted != wantDeleted {
+		t.Errorf("Unfollow() deleted %+v, want %+v", store.deleted, wantDeleted)
+	}
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"sync/atomic"
+	"time"
 
+	"github.com/deexth/chirpy/internal/auth"
 	"github.com/deexth/chirpy/internal/database"
+	"github.com/deexth/chirpy/internal/mailer"
+	"github.com/deexth/chirpy/internal/oidc"
+	"github.com/deexth/chirpy/internal/throttle"
+	"github.com/deexth/chirpy/internal/timeline"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -15,8 +23,20 @@ import (
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
+	conn           *sql.DB
 	platform       string
-	tokenSecret    string
+	keyring        *auth.Keyring
+	polkaKey       string
+	mailer         mailer.Mailer
+	baseURL        string
+	throttle       *throttle.Throttler
+	hasher         *auth.PasswordHasher
+	passwordPolicy *auth.PasswordPolicy
+	oidc           *oidc.Provider
+	timeline       *timeline.Fanout
+
+	deletionGracePeriod time.Duration
+	exportWake          chan struct{}
 }
 
 func main() {
@@ -31,9 +51,118 @@ func main() {
 		log.Fatal("No platform set")
 	}
 
-	tSecret := os.Getenv("TOKEN_SECRET")
-	if tSecret == "" {
-		log.Fatal("No token secret found")
+	// TOKEN_KEYS holds id:secret pairs and TOKEN_KEY_FILES id:path pairs of
+	// PEM keys so keys can be rolled; a lone TOKEN_SECRET is still accepted
+	// as a keyring with a single key.
+	tokenKeys := os.Getenv("TOKEN_KEYS")
+	tokenKeyFiles := os.Getenv("TOKEN_KEY_FILES")
+	activeKey := os.Getenv("TOKEN_ACTIVE_KEY")
+	if tokenKeys == "" && tokenKeyFiles == "" {
+		tSecret := os.Getenv("TOKEN_SECRET")
+		if tSecret == "" {
+			log.Fatal("No token secret found")
+		}
+		tokenKeys = "default:" + tSecret
+		activeKey = "default"
+	}
+
+	keyring, err := auth.LoadKeyring(tokenKeys, tokenKeyFiles, activeKey, os.Getenv("TOKEN_RETIRED_KEYS"))
+	if err != nil {
+		log.Fatalf("Couldn't load the token keyring: %v", err)
+	}
+
+	polkaKey := os.Getenv("POLKA_KEY")
+	if polkaKey == "" {
+		log.Fatal("No polka key found")
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "Chirpy <no-reply@localhost>"
+	}
+
+	var mail mailer.Mailer
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		mail, err = mailer.NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			mailFrom,
+		)
+		if err != nil {
+			log.Fatalf("Invalid SMTP mailer config: %v", err)
+		}
+	case "", "file":
+		if os.Getenv("MAILER") == "" {
+			if platform != "dev" {
+				log.Fatal("MAILER must be set outside the dev platform")
+			}
+			log.Print("MAILER not set, writing mail to files")
+		}
+		mailDir := os.Getenv("MAIL_DIR")
+		if mailDir == "" {
+			mailDir = "mail"
+		}
+		mail = mailer.NewFileMailer(mailDir, mailFrom)
+	default:
+		log.Fatalf("Unknown mailer: %s", os.Getenv("MAILER"))
+	}
+
+	hashParams, err := auth.ParseHashParams(
+		os.Getenv("ARGON2_MEMORY_KIB"),
+		os.Getenv("ARGON2_ITERATIONS"),
+		os.Getenv("ARGON2_PARALLELISM"),
+	)
+	if err != nil {
+		log.Fatalf("Invalid password hashing parameters: %v", err)
+	}
+
+	minPasswordLength := 8
+	if s := os.Getenv("PASSWORD_MIN_LENGTH"); s != "" {
+		minPasswordLength, err = strconv.Atoi(s)
+		if err != nil || minPasswordLength < 1 {
+			log.Fatalf("Invalid PASSWORD_MIN_LENGTH: %q", s)
+		}
+	}
+
+	passwordPolicy := auth.NewPasswordPolicy(minPasswordLength, 128)
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		if err := passwordPolicy.LoadBreachedPasswordsDir(dir); err != nil {
+			log.Fatalf("Couldn't load breached passwords: %v", err)
+		}
+	}
+
+	// Deleted accounts can be restored by logging in until the grace
+	// period is over.
+	deletionGracePeriod := 30 * 24 * time.Hour
+	if s := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"); s != "" {
+		deletionGracePeriod, err = time.ParseDuration(s)
+		if err != nil || deletionGracePeriod < 0 {
+			log.Fatalf("Invalid ACCOUNT_DELETION_GRACE_PERIOD: %q", s)
+		}
+	}
+
+	// Signing in through an OpenID provider is optional and only enabled
+	// when an issuer is configured.
+	var oidcProvider *oidc.Provider
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		clientID := os.Getenv("OIDC_CLIENT_ID")
+		if clientID == "" {
+			log.Fatal("OIDC_ISSUER is set but OIDC_CLIENT_ID is missing")
+		}
+		oidcProvider = oidc.NewProvider(oidc.Config{
+			Issuer:       issuer,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/api/oidc/callback",
+		}, &http.Client{Timeout: 10 * time.Second})
 	}
 
 	db, err := sql.Open("postgres", dbURL)
@@ -47,8 +176,20 @@ func main() {
 	apicfg := apiConfig{
 		fileserverHits: atomic.Int32{},
 		db:             dbQueries,
+		conn:           db,
 		platform:       platform,
-		tokenSecret:    tSecret,
+		keyring:        keyring,
+		polkaKey:       polkaKey,
+		mailer:         mail,
+		baseURL:        baseURL,
+		throttle:       throttle.New(dbQueries),
+		hasher:         auth.NewPasswordHasher(hashParams),
+		passwordPolicy: passwordPolicy,
+		oidc:           oidcProvider,
+		timeline:       timeline.New(dbQueries, 4, 1024),
+
+		deletionGracePeriod: deletionGracePeriod,
+		exportWake:          make(chan struct{}, 1),
 	}
 	mux.Handle("/app/", apicfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir("./")))))
 	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -58,17 +199,66 @@ func main() {
 			log.Fatalf("couldn't write to the body: %v", err)
 		}
 	})
-	mux.HandleFunc("GET /admin/metrics", apicfg.handlerMetrics)
-	mux.HandleFunc("POST /admin/reset", apicfg.handleReset)
+	mux.HandleFunc("GET /.well-known/jwks.json", apicfg.handleJWKS)
+
+	// Everything under /admin/ needs an admin access token. Reset is
+	// additionally limited to the dev platform.
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("GET /admin/metrics", apicfg.handlerMetrics)
+	adminMux.HandleFunc("POST /admin/reset", apicfg.handleReset)
+	adminMux.HandleFunc("PUT /admin/users/{userID}/role", apicfg.handleSetUserRole)
+	mux.Handle("/admin/", apicfg.requireRole(auth.RoleAdmin, adminMux))
+
 	mux.HandleFunc("POST /api/users", apicfg.handleUsers)
-	mux.HandleFunc("PUT /api/users", apicfg.handleUpdateUser)
+	mux.HandleFunc("PUT /api/users", apicfg.requireAuth(apicfg.handleUpdateUser))
+	mux.HandleFunc("DELETE /api/users", apicfg.requireAuth(apicfg.handleDeleteUser))
+	mux.HandleFunc("PATCH /api/users/me", apicfg.requireAuth(apicfg.handlePatchUser))
+	mux.HandleFunc("POST /api/users/me/export", apicfg.requireAuth(apicfg.handleRequestExport))
+	mux.HandleFunc("GET /api/users/me/export", apicfg.requireAuth(apicfg.handleGetExport))
+	mux.HandleFunc("PUT /api/users/me/profile", apicfg.requireScope(auth.ScopeProfileWrite, apicfg.handleUpdateProfile))
+	mux.HandleFunc("GET /api/users/{userRef}", apicfg.handleGetProfile)
+	mux.HandleFunc("POST /api/users/{userRef}/follow", apicfg.requireAuth(apicfg.handleFollow))
+	mux.HandleFunc("DELETE /api/users/{userRef}/follow", apicfg.requireAuth(apicfg.handleUnfollow))
+	mux.HandleFunc("GET /api/users/{userRef}/followers", apicfg.handleListFollowers)
+	mux.HandleFunc("GET /api/users/{userRef}/following", apicfg.handleListFollowing)
+	mux.HandleFunc("GET /api/timeline", apicfg.requireAuth(apicfg.handleTimeline))
+	mux.HandleFunc("GET /api/users/verify", apicfg.handleVerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apicfg.requireAuth(apicfg.handleResendVerification))
 	mux.HandleFunc("POST /api/login", apicfg.handleLogin)
-	mux.HandleFunc("POST /api/chirps", apicfg.handleChirps)
-	mux.HandleFunc("GET /api/chirps", apicfg.handleGetChirps)
+	mux.HandleFunc("POST /api/login/mfa", apicfg.handleLoginMFA)
+	if apicfg.oidc != nil {
+		mux.HandleFunc("GET /api/oidc/login", apicfg.handleOIDCLogin)
+		mux.HandleFunc("GET /api/oidc/callback", apicfg.handleOIDCCallback)
+	}
+	mux.HandleFunc("POST /api/2fa/setup", apicfg.requireAuth(apicfg.handle2FASetup))
+	mux.HandleFunc("POST /api/2fa/verify", apicfg.requireAuth(apicfg.handle2FAVerify))
+	mux.HandleFunc("POST /api/password-reset/request", apicfg.handlePasswordResetRequest)
+	mux.HandleFunc("POST /api/password-reset/confirm", apicfg.handlePasswordResetConfirm)
+	mux.HandleFunc("POST /api/chirps", apicfg.requireScope(auth.ScopeChirpsWrite, apicfg.handleChirps))
+	mux.HandleFunc("GET /api/chirps", apicfg.optionalAuth(apicfg.handleGetChirps))
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apicfg.handleGetChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apicfg.handleChirpDeletion)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/replies", apicfg.handleGetReplies)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apicfg.handleGetThread)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apicfg.requireScope(auth.ScopeChirpsWrite, apicfg.handleChirpDeletion))
 	mux.HandleFunc("POST /api/refresh", apicfg.handleRefresh)
 	mux.HandleFunc("POST /api/revoke", apicfg.handleRevoke)
+	mux.HandleFunc("GET /api/sessions", apicfg.requireAuth(apicfg.handleListSessions))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apicfg.requireAuth(apicfg.handleRevokeSession))
+	mux.HandleFunc("POST /api/logout-all", apicfg.requireAuth(apicfg.handleLogoutAll))
+	mux.HandleFunc("POST /api/keys", apicfg.requireAuth(apicfg.handleCreateAPIKey))
+	mux.HandleFunc("GET /api/keys", apicfg.requireAuth(apicfg.handleListAPIKeys))
+	mux.HandleFunc("DELETE /api/keys/{keyID}", apicfg.requireAuth(apicfg.handleDeleteAPIKey))
+	mux.HandleFunc("POST /api/oauth/clients", apicfg.requireAuth(apicfg.handleCreateOAuthClient))
+	mux.HandleFunc("GET /api/oauth/clients", apicfg.requireAuth(apicfg.handleListOAuthClients))
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apicfg.requireAuth(apicfg.handleDeleteOAuthClient))
+	mux.HandleFunc("GET /api/oauth/authorize", apicfg.requireAuth(apicfg.handleOAuthAuthorize))
+	mux.HandleFunc("POST /api/oauth/authorize", apicfg.requireAuth(apicfg.handleOAuthConsent))
+	mux.HandleFunc("POST /api/oauth/token", apicfg.handleOAuthToken)
+	mux.HandleFunc("POST /api/polka/webhooks", apicfg.handlePolkaWebhook)
+
+	go apicfg.purgeDeletedUsers(context.Background(), time.Hour)
+	go apicfg.runExportWorker(context.Background())
+	go apicfg.timeline.Run(context.Background())
 
 	server := &http.Server{
 		Addr:    ":8080",
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/deexth/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// principal is the authenticated caller of a request. Claims is set for
+// access tokens; Scopes is set for delegated credentials such as API
+// keys and OAuth access tokens, which may only do what their scopes
+// allow.
+type principal struct {
+	UserID    uuid.UUID
+	Role      string
+	Claims    *auth.AccessClaims
+	Delegated bool
+	Scopes    []string
+}
+
+// can reports whether the caller may act within scope. Sessions started
+// by the user themselves are not limited by scopes.
+func (p principal) can(scope string) bool {
+	return !p.Delegated || auth.HasScope(p.Scopes, scope)
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+// requireAuth rejects requests without a valid access token from the
+// user themselves and makes the caller available to next through
+// requestPrincipal. Delegated tokens are turned away; endpoints they may
+// use are wrapped in requireScope instead.
+func (cfg *apiConfig) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := cfg.authenticate(r)
+		if errors.Is(err, errLookupFailed) {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+		if err != nil {
+			respondUnauthorized(w, r, err)
+			return
+		}
+
+		if p.Delegated {
+			respondInsufficientScope(w, "")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey, p)))
+	}
+}
+
+// optionalAuth is for public endpoints: requests without an
+// Authorization header go through anonymously, but a token that is sent
+// must be valid so clients notice when it expires.
+func (cfg *apiConfig) optionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
+			return
+		}
+
+		p, err := cfg.authenticate(r)
+		if errors.Is(err, errLookupFailed) {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+		if err != nil {
+			respondUnauthorized(w, r, err)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey, p)))
+	}
+}
+
+// requireRole only lets requests through whose access token carries role.
+func (cfg *apiConfig) requireRole(role string, next http.Handler) http.Handler {
+	return cfg.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if p, _ := requestPrincipal(r); p.Role != role {
+			respondWithError(w, http.StatusForbidden, "forbidden", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope is requireAuth that also accepts API keys, as long as
+// the caller's credential grants scope.
+func (cfg *apiConfig) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var p principal
+		var err error
+		if strings.HasPrefix(r.Header.Get("Authorization"), "ApiKey ") {
+			p, err = cfg.authenticateAPIKey(r)
+		} else {
+			p, err = cfg.authenticate(r)
+		}
+		if errors.Is(err, errLookupFailed) {
+			respondWithError(w, http.StatusInternalServerError, "something went wrong", err)
+			return
+		}
+		if err != nil {
+			w.Header().Add("WWW-Authenticate", `ApiKey realm="chirpy"`)
+			respondUnauthorized(w, r, err)
+			return
+		}
+
+		if !p.can(scope) {
+			respondInsufficientScope(w, scope)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey, p)))
+	}
+}
+
+func (cfg *apiConfig) authenticate(r *http.Request) (principal, error) {
+	accessToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return principal{}, err
+	}
+
+	claims, err := cfg.keyring.ParseAccessToken(accessToken)
+	if err != nil {
+		return principal{}, err
+	}
+
+	userID := uuid.MustParse(claims.Subject)
+	if err := cfg.checkAccountActive(r.Context(), userID); err != nil {
+		return principal{}, err
+	}
+
+	return principal{
+		UserID:    userID,
+		Role:      claims.Role,
+		Claims:    claims,
+		Delegated: claims.ClientID != "",
+		Scopes:    strings.Fields(claims.Scope),
+	}, nil
+}
+
+var errLookupFailed = errors.New("couldn't look up credentials")
+
+func (cfg *apiConfig) authenticateAPIKey(r *http.Request) (principal, error) {
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return principal{}, err
+	}
+
+	key, err := cfg.db.UseAPIKey(r.Context(), auth.HashToken(apiKey))
+	if errors.Is(err, sql.ErrNoRows) {
+		return principal{}, errors.New("unknown or expired api key")
+	}
+	if err != nil {
+		return principal{}, fmt.Errorf("%w: %v", errLookupFailed, err)
+	}
+
+	if err := cfg.checkAccountActive(r.Context(), key.UserID); err != nil {
+		return principal{}, err
+	}
+
+	return principal{
+		UserID:    key.UserID,
+		Role:      auth.RoleUser,
+		Delegated: true,
+		Scopes:    key.Scopes,
+	}, nil
+}
+
+// checkAccountActive turns away credentials that outlive their account:
+// tokens issued before the account was scheduled for deletion, or before
+// it was purged, stop working right away.
+func (cfg *apiConfig) checkAccountActive(ctx context.Context, userID uuid.UUID) error {
+	deleteAfter, err := cfg.db.GetUserDeleteAfter(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("account no longer exists")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errLookupFailed, err)
+	}
+	if deleteAfter.Valid {
+		return errors.New("account is scheduled for deletion")
+	}
+
+	return nil
+}
+
+// requestPrincipal returns the caller stored by requireAuth or
+// optionalAuth. ok is false for anonymous requests.
+func requestPrincipal(r *http.Request) (p principal, ok bool) {
+	p, ok = r.Context().Value(principalKey).(principal)
+	return p, ok
+}
+
+// respondUnauthorized answers with a 401 and the WWW-Authenticate
+// challenge from RFC 6750. A request that sent no credentials at all
+// gets the challenge without an error code.
+func respondUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	challenge := `Bearer realm="chirpy"`
+	if r.Header.Get("Authorization") != "" {
+		challenge += `, error="invalid_token"`
+	}
+
+	w.Header().Add("WWW-Authenticate", challenge)
+	respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
+}
+
+// requestUserID returns the ID of the caller authenticated by
+// requireAuth.
+func requestUserID(r *http.Request) uuid.UUID {
+	p, _ := requestPrincipal(r)
+	return p.UserID
+}
+
+// respondInsufficientScope answers with a 403 for a delegated caller
+// whose credential doesn't grant scope, or any delegated caller at all
+// when scope is empty.
+func respondInsufficientScope(w http.ResponseWriter, scope string) {
+	challenge := `Bearer realm="chirpy", error="insufficient_scope"`
+	if scope != "" {
+		challenge += fmt.Sprintf(`, scope=%q`, scope)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	respondWithError(w, http.StatusForbidden, "insufficient scope", nil)
+}
@@ -0,0 +1,29 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+    id,
+    user_id,
+    name,
+    key_hash,
+    prefix,
+    scopes,
+    expires_at
+) VALUES ( $1, $2, $3, $4, $5, $6, $7 )
+RETURNING *;
+
+-- name: ListUserAPIKeys :many
+SELECT *
+    FROM api_keys
+    WHERE user_id = $1
+    ORDER BY created_at DESC;
+
+-- name: DeleteUserAPIKey :execrows
+DELETE FROM api_keys WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteUserAPIKeys :exec
+DELETE FROM api_keys WHERE user_id = $1;
+
+-- name: UseAPIKey :one
+UPDATE api_keys
+    SET last_used_at = NOW()
+    WHERE key_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())
+    RETURNING user_id, scopes;
@@ -0,0 +1,14 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+    id,
+    user_id,
+    action,
+    detail,
+    ip,
+    user_agent
+) VALUES ( $1, $2, $3, $4, $5, $6 );
+
+-- name: ListUserAuditEvents :many
+SELECT * FROM audit_events
+    WHERE user_id = $1
+    ORDER BY created_at ASC, id ASC;
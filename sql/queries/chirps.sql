@@ -2,14 +2,31 @@
 INSERT INTO chirps (
     id,
     body,
-    user_id
-) VALUES ( $1, $2, $3 ) RETURNING *;
+    user_id,
+    in_reply_to
+) VALUES ( $1, $2, $3, $4 ) RETURNING *;
 
--- name: GetChirps :many
+-- name: ListChirpsAsc :many
 SELECT *
     FROM chirps
-    ORDER BY updated_at
-    LIMIT $1;
+    WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+    AND (
+        sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid)
+    )
+    ORDER BY created_at ASC, id ASC
+    LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT *
+    FROM chirps
+    WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+    AND (
+        sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (created_at, id) < (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid)
+    )
+    ORDER BY created_at DESC, id DESC
+    LIMIT sqlc.arg('limit');
 
 -- name: GetChirp :one
 SELECT * FROM chirps WHERE id = $1;
@@ -17,3 +34,65 @@ SELECT * FROM chirps WHERE id = $1;
 -- name: DeleteChirp :execrows
 DELETE FROM chirps
     WHERE id = $1 AND user_id = $2;
+
+-- name: ListUserChirps :many
+SELECT * FROM chirps
+    WHERE user_id = $1
+    ORDER BY created_at ASC, id ASC;
+
+-- name: ListChirpReplies :many
+SELECT *
+    FROM chirps
+    WHERE in_reply_to = sqlc.arg('chirp_id')
+    AND (
+        sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid)
+    )
+    ORDER BY created_at ASC, id ASC
+    LIMIT sqlc.arg('limit');
+
+-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.in_reply_to, 1 AS depth
+        FROM chirps AS child
+        JOIN chirps AS parent ON parent.id = child.in_reply_to
+        WHERE child.id = sqlc.arg('chirp_id')
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, ancestors.depth + 1
+        FROM chirps
+        JOIN ancestors ON chirps.id = ancestors.in_reply_to
+        WHERE ancestors.depth < sqlc.arg('max_depth')::integer
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to
+    FROM ancestors
+    ORDER BY depth DESC;
+
+-- name: ListChirpDescendants :many
+-- Each chirp contributes at most limit replies, and the walk, which goes
+-- level by level, stops after limit rows, so a huge subtree is never
+-- expanded in full before sorting.
+WITH RECURSIVE descendants AS (
+    (SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, 1 AS depth
+        FROM chirps
+        WHERE chirps.in_reply_to = sqlc.arg('chirp_id')
+        ORDER BY chirps.created_at ASC, chirps.id ASC
+        LIMIT sqlc.arg('limit'))
+    UNION ALL
+    SELECT replies.id, replies.created_at, replies.updated_at, replies.body, replies.user_id, replies.in_reply_to, descendants.depth + 1
+        FROM descendants
+        CROSS JOIN LATERAL (
+            SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to
+                FROM chirps
+                WHERE chirps.in_reply_to = descendants.id
+                ORDER BY chirps.created_at ASC, chirps.id ASC
+                LIMIT sqlc.arg('limit')
+        ) replies
+        WHERE descendants.depth < sqlc.arg('max_depth')::integer
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to
+    FROM (
+        SELECT id, created_at, updated_at, body, user_id, in_reply_to
+            FROM descendants
+            LIMIT sqlc.arg('limit')
+    ) bounded
+    ORDER BY created_at ASC, id ASC;
@@ -0,0 +1,45 @@
+-- name: CreateExportJob :one
+INSERT INTO export_jobs (
+    id,
+    user_id
+) VALUES ( $1, $2 )
+RETURNING id, created_at, status, completed_at, expires_at;
+
+-- name: GetLatestUserExportJob :one
+SELECT id, created_at, status, completed_at, expires_at
+    FROM export_jobs
+    WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+    ORDER BY created_at DESC
+    LIMIT 1;
+
+-- name: GetUserExportArchive :one
+SELECT archive
+    FROM export_jobs
+    WHERE id = $1 AND user_id = $2 AND status = 'done' AND expires_at > NOW();
+
+-- name: ClaimExportJob :one
+UPDATE export_jobs
+    SET status = 'running', started_at = NOW(), updated_at = NOW()
+    WHERE id = (
+        SELECT id FROM export_jobs
+            WHERE status = 'pending'
+            OR (status = 'running' AND started_at < NOW() - (sqlc.arg('stale_seconds')::integer * INTERVAL '1 second'))
+            ORDER BY created_at ASC
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+    )
+    RETURNING id, user_id;
+
+-- name: CompleteExportJob :exec
+UPDATE export_jobs
+    SET status = 'done', archive = $2, expires_at = $3, completed_at = NOW(), updated_at = NOW()
+    WHERE id = $1;
+
+-- name: FailExportJob :exec
+UPDATE export_jobs
+    SET status = 'failed', error = $2, completed_at = NOW(), updated_at = NOW()
+    WHERE id = $1;
+
+-- name: DeleteExpiredExportJobs :execrows
+DELETE FROM export_jobs
+    WHERE expires_at <= NOW();
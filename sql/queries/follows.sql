@@ -0,0 +1,34 @@
+-- name: FollowUser :execrows
+INSERT INTO follows (
+    follower_id,
+    followee_id
+) VALUES ( $1, $2 )
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :execrows
+DELETE FROM follows
+    WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFollowers :many
+SELECT users.id, users.handle, users.display_name, users.avatar_url, follows.created_at
+    FROM follows
+    JOIN users ON users.id = follows.follower_id
+    WHERE follows.followee_id = sqlc.arg('user_id')
+    AND (
+        sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (follows.created_at, follows.follower_id) < (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid)
+    )
+    ORDER BY follows.created_at DESC, follows.follower_id DESC
+    LIMIT sqlc.arg('limit');
+
+-- name: ListFollowing :many
+SELECT users.id, users.handle, users.display_name, users.avatar_url, follows.created_at
+    FROM follows
+    JOIN users ON users.id = follows.followee_id
+    WHERE follows.follower_id = sqlc.arg('user_id')
+    AND (
+        sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (follows.created_at, follows.followee_id) < (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid)
+    )
+    ORDER BY follows.created_at DESC, follows.followee_id DESC
+    LIMIT sqlc.arg('limit');
@@ -0,0 +1,44 @@
+-- name: ReserveLoginAttempt :one
+-- Counts an attempt up front and locks the key as if it will fail, in
+-- one statement, so concurrent attempts can't all slip past the check.
+-- A key that is already locked is left alone and reserved is false.
+INSERT INTO login_attempts (
+    key,
+    failures,
+    last_failure_at,
+    locked_until
+) VALUES (
+    sqlc.arg('key'),
+    1,
+    NOW(),
+    NOW() + (NULLIF((sqlc.arg('lockouts')::integer[])[1], 0) * INTERVAL '1 second')
+)
+ON CONFLICT (key) DO UPDATE
+    SET failures = CASE
+            WHEN login_attempts.locked_until > NOW() THEN login_attempts.failures
+            WHEN login_attempts.last_failure_at < NOW() - (sqlc.arg('window_seconds')::integer * INTERVAL '1 second') THEN 1
+            ELSE login_attempts.failures + 1
+        END,
+        last_failure_at = CASE
+            WHEN login_attempts.locked_until > NOW() THEN login_attempts.last_failure_at
+            ELSE NOW()
+        END,
+        locked_until = CASE
+            WHEN login_attempts.locked_until > NOW() THEN login_attempts.locked_until
+            WHEN login_attempts.last_failure_at < NOW() - (sqlc.arg('window_seconds')::integer * INTERVAL '1 second')
+                THEN NOW() + (NULLIF((sqlc.arg('lockouts')::integer[])[1], 0) * INTERVAL '1 second')
+            ELSE NOW() + (NULLIF((sqlc.arg('lockouts')::integer[])[LEAST(login_attempts.failures + 1, cardinality(sqlc.arg('lockouts')::integer[]))], 0) * INTERVAL '1 second')
+        END
+    RETURNING last_failure_at = NOW() AS reserved, COALESCE(CEIL(EXTRACT(EPOCH FROM (locked_until - NOW()))), 0)::integer AS retry_after;
+
+-- name: ReleaseLoginAttempt :exec
+UPDATE login_attempts
+    SET failures = GREATEST(failures - 1, 0),
+        locked_until = CASE
+            WHEN failures - 1 <= sqlc.arg('free_attempts')::integer THEN NULL
+            ELSE locked_until
+        END
+    WHERE key = sqlc.arg('key');
+
+-- name: ClearLoginAttempts :exec
+DELETE FROM login_attempts WHERE key = $1;
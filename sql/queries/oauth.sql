@@ -0,0 +1,51 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (
+    id,
+    owner_id,
+    name,
+    secret_hash,
+    redirect_uris,
+    scopes
+) VALUES ( $1, $2, $3, $4, $5, $6 )
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id = $1;
+
+-- name: ListUserOAuthClients :many
+SELECT *
+    FROM oauth_clients
+    WHERE owner_id = $1
+    ORDER BY created_at DESC;
+
+-- name: DeleteUserOAuthClient :execrows
+DELETE FROM oauth_clients WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+    code_hash,
+    client_id,
+    user_id,
+    redirect_uri,
+    scopes,
+    code_challenge,
+    expires_at
+) VALUES ( $1, $2, $3, $4, $5, $6, $7 );
+
+-- name: UseOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+    SET used_at = NOW()
+    WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+    RETURNING *;
+
+-- name: GetOAuthConsent :one
+SELECT scopes FROM oauth_consents WHERE user_id = $1 AND client_id = $2;
+
+-- name: UpsertOAuthConsent :exec
+INSERT INTO oauth_consents (
+    user_id,
+    client_id,
+    scopes
+) VALUES ( $1, $2, $3 )
+ON CONFLICT (user_id, client_id)
+DO UPDATE SET scopes = EXCLUDED.scopes, updated_at = NOW();
@@ -0,0 +1,13 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (
+    code_hash,
+    user_id
+) VALUES ( $1, $2 );
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+    SET used_at = NOW()
+    WHERE code_hash = $1 AND user_id = $2 AND used_at IS NULL;
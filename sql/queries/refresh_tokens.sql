@@ -1,14 +1,57 @@
--- name: CreateRefreshToken :one
+-- name: CreateRefreshToken :exec
 INSERT INTO refresh_tokens (
-    token,
+    token_hash,
     user_id,
-    expires_at
-) VALUES ( $1, $2, $3 ) RETURNING token;
+    family_id,
+    expires_at,
+    user_agent,
+    ip,
+    client_id,
+    scopes
+) VALUES ( $1, $2, $3, $4, $5, $6, $7, $8 );
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1;
 
 -- name: GetRefreshTokenUser :one
-SELECT user_id FROM refresh_tokens WHERE token = $1 AND expires_at > NOW() AND revoked_at IS NULL;
+SELECT user_id FROM refresh_tokens WHERE token_hash = $1 AND expires_at > NOW() AND revoked_at IS NULL;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+    SET revoked_at = NOW(), updated_at = NOW(), last_used_at = NOW(), replaced_by = $2
+    WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW();
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
     SET revoked_at = NOW(), updated_at = NOW()
-    WHERE token = $1;
+    WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(), updated_at = NOW()
+    WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: ListUserSessions :many
+-- Rotation replaces the live row, so the login time and device come from
+-- the first token in the family.
+SELECT rt.family_id, origin.user_agent, origin.ip, origin.created_at, rt.last_used_at, rt.expires_at, rt.client_id
+    FROM refresh_tokens rt
+    JOIN LATERAL (
+        SELECT user_agent, ip, created_at
+            FROM refresh_tokens
+            WHERE family_id = rt.family_id
+            ORDER BY created_at
+            LIMIT 1
+    ) origin ON TRUE
+    WHERE rt.user_id = $1 AND rt.revoked_at IS NULL AND rt.expires_at > NOW()
+    ORDER BY rt.last_used_at DESC;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+    SET revoked_at = NOW(), updated_at = NOW()
+    WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(), updated_at = NOW()
+    WHERE user_id = $1 AND revoked_at IS NULL;
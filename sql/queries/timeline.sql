@@ -0,0 +1,50 @@
+-- name: QueueChirpFanout :exec
+WITH own AS (
+    INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+        SELECT user_id, id, user_id, created_at FROM chirps WHERE id = $1
+        ON CONFLICT DO NOTHING
+)
+INSERT INTO timeline_fanouts (chirp_id) VALUES ( $1 );
+
+-- name: FanOutChirp :execrows
+WITH copied AS (
+    INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+        SELECT follows.follower_id, chirps.id, chirps.user_id, chirps.created_at
+        FROM chirps
+        JOIN follows ON follows.followee_id = chirps.user_id
+        WHERE chirps.id = $1
+        ON CONFLICT DO NOTHING
+)
+DELETE FROM timeline_fanouts WHERE chirp_id = $1;
+
+-- name: ListStaleFanouts :many
+SELECT chirp_id
+    FROM timeline_fanouts
+    WHERE created_at < sqlc.arg('before')
+    ORDER BY created_at ASC
+    LIMIT sqlc.arg('limit');
+
+-- name: BackfillTimeline :execrows
+INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+    SELECT sqlc.arg('user_id')::uuid, id, user_id, created_at
+    FROM chirps
+    WHERE user_id = sqlc.arg('author_id')
+    ORDER BY created_at DESC
+    LIMIT sqlc.arg('limit')
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteTimelineAuthorEntries :execrows
+DELETE FROM timeline_entries
+    WHERE user_id = $1 AND author_id = $2;
+
+-- name: ListTimeline :many
+SELECT chirps.*
+    FROM timeline_entries
+    JOIN chirps ON chirps.id = timeline_entries.chirp_id
+    WHERE timeline_entries.user_id = sqlc.arg('user_id')
+    AND (
+        sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (timeline_entries.created_at, timeline_entries.chirp_id) < (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid)
+    )
+    ORDER BY timeline_entries.created_at DESC, timeline_entries.chirp_id DESC
+    LIMIT sqlc.arg('limit');
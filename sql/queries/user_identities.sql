@@ -0,0 +1,10 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (
+    issuer,
+    subject,
+    user_id,
+    email
+) VALUES ( $1, $2, $3, $4 );
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities WHERE issuer = $1 AND subject = $2;
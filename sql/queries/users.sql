@@ -2,15 +2,113 @@
 INSERT INTO users (
     id,
     email,
-    password
-) VALUES ( $1, $2, $3 ) RETURNING id, email, created_at, updated_at;
+    password,
+    handle
+) VALUES ( $1, $2, $3, $4 ) RETURNING id, email, created_at, updated_at, is_chirpy_red, role, handle;
 
 -- name: GetUser :one
 SELECT *
     FROM users
     WHERE email = $1;
 
--- name: UpdateUserPassword :exec
+-- name: GetUserByID :one
+SELECT *
+    FROM users
+    WHERE id = $1;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+    SET password = $2, pending_email = $3, updated_at = NOW()
+    WHERE id = $1
+    RETURNING id, created_at, updated_at, email, is_chirpy_red, email_verified_at, pending_email, role, handle;
+
+-- name: UpgradeUserToChirpyRed :execrows
 UPDATE users
-    SET password = $2, email = $3
+    SET is_chirpy_red = TRUE, updated_at = NOW()
     WHERE id = $1;
+
+-- name: SetUserPassword :exec
+UPDATE users
+    SET password = $2, updated_at = NOW()
+    WHERE id = $1;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users
+    SET email = $2, pending_email = NULL, email_verified_at = NOW(), updated_at = NOW()
+    WHERE id = $1 AND (email = $2 OR pending_email = $2);
+
+-- name: SetUserTOTPSecret :execrows
+UPDATE users
+    SET totp_secret = $2, updated_at = NOW()
+    WHERE id = $1 AND totp_enabled_at IS NULL;
+
+-- name: EnableUserTOTP :execrows
+UPDATE users
+    SET totp_enabled_at = NOW(), updated_at = NOW()
+    WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL;
+
+-- name: RecordUserTOTPStep :execrows
+UPDATE users
+    SET totp_last_step = $2
+    WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2);
+
+-- name: RehashUserPassword :execrows
+UPDATE users
+    SET password = sqlc.arg('new_password')
+    WHERE id = sqlc.arg('id') AND password = sqlc.arg('old_password');
+
+-- name: SetUserRole :execrows
+UPDATE users
+    SET role = $2, updated_at = NOW()
+    WHERE id = $1;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+    SET delete_after = COALESCE(delete_after, sqlc.arg('delete_after')::timestamp), updated_at = NOW()
+    WHERE id = sqlc.arg('id')
+    RETURNING delete_after;
+
+-- name: GetUserDeleteAfter :one
+SELECT delete_after FROM users WHERE id = $1;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+    SET delete_after = NULL, updated_at = NOW()
+    WHERE id = $1 AND delete_after IS NOT NULL;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+    WHERE delete_after IS NOT NULL AND delete_after <= NOW();
+
+-- name: GetUserProfile :one
+SELECT id, created_at, handle, display_name, bio, avatar_url, is_chirpy_red
+    FROM users
+    WHERE id = $1;
+
+-- name: GetUserProfileByHandle :one
+SELECT id, created_at, handle, display_name, bio, avatar_url, is_chirpy_red
+    FROM users
+    WHERE handle = $1;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+    SET handle = $2, display_name = $3, bio = $4, avatar_url = $5, updated_at = NOW()
+    WHERE id = $1
+    RETURNING id, created_at, handle, display_name, bio, avatar_url, is_chirpy_red;
+
+-- name: ListChirpAuthors :many
+SELECT id, handle, display_name, avatar_url
+    FROM users
+    WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: PatchUser :one
+UPDATE users
+    SET password = COALESCE(sqlc.narg('password'), password),
+        pending_email = CASE WHEN sqlc.arg('set_pending_email')::boolean THEN sqlc.narg('pending_email') ELSE pending_email END,
+        handle = COALESCE(sqlc.narg('handle'), handle),
+        display_name = COALESCE(sqlc.narg('display_name'), display_name),
+        bio = COALESCE(sqlc.narg('bio'), bio),
+        avatar_url = COALESCE(sqlc.narg('avatar_url'), avatar_url),
+        updated_at = NOW()
+    WHERE id = sqlc.arg('id')
+    RETURNING *;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Re-key existing rows with the same digest auth.HashToken produces so
+-- sessions survive the upgrade.
+UPDATE refresh_tokens SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+UPDATE refresh_tokens
+    SET replaced_by = encode(sha256(convert_to(replaced_by, 'UTF8')), 'hex')
+    WHERE replaced_by IS NOT NULL;
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+
+-- +goose Down
+-- Digests can't be reversed, so every session is lost on rollback.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email TEXT;
+-- Accounts created before verification existed keep their address.
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Promote the first operator by hand; after that admins manage roles
+-- through PUT /admin/users/{userID}/role.
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'admin'));
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS role;
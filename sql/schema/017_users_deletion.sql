@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS delete_after TIMESTAMP;
+CREATE INDEX IF NOT EXISTS users_delete_after_idx ON users (delete_after) WHERE delete_after IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS users_delete_after_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS delete_after;
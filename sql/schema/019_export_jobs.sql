@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'failed')),
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    archive BYTEA,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS export_jobs_user_id_created_at_idx ON export_jobs (user_id, created_at);
+CREATE INDEX IF NOT EXISTS export_jobs_pending_idx ON export_jobs (created_at) WHERE status IN ('pending', 'running');
+
+-- +goose Down
+DROP TABLE IF EXISTS export_jobs;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS handle TEXT;
+UPDATE users SET handle = 'user_' || substr(replace(id::text, '-', ''), 1, 12) WHERE handle IS NULL;
+ALTER TABLE users ALTER COLUMN handle SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_handle_key UNIQUE (handle);
+ALTER TABLE users ADD CONSTRAINT users_handle_check CHECK (handle ~ '^[a-z0-9_]{3,30}$');
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
+ALTER TABLE users DROP COLUMN IF EXISTS handle;
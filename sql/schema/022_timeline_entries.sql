@@ -0,0 +1,33 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS timeline_entries (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    author_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX IF NOT EXISTS timeline_entries_user_id_created_at_idx ON timeline_entries (user_id, created_at, chirp_id);
+CREATE INDEX IF NOT EXISTS timeline_entries_user_id_author_id_idx ON timeline_entries (user_id, author_id);
+CREATE INDEX IF NOT EXISTS timeline_entries_chirp_id_idx ON timeline_entries (chirp_id);
+
+-- Chirps still waiting to be copied into their author's followers'
+-- timelines.
+CREATE TABLE IF NOT EXISTS timeline_fanouts (
+    chirp_id UUID PRIMARY KEY REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+    SELECT user_id, id, user_id, created_at FROM chirps
+    ON CONFLICT DO NOTHING;
+
+INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+    SELECT follows.follower_id, chirps.id, chirps.user_id, chirps.created_at
+    FROM follows
+    JOIN chirps ON chirps.user_id = follows.followee_id
+    ON CONFLICT DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS timeline_fanouts;
+DROP TABLE IF EXISTS timeline_entries;
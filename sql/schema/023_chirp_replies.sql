@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE chirps ADD COLUMN IF NOT EXISTS in_reply_to UUID REFERENCES chirps(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS chirps_in_reply_to_created_at_id_idx ON chirps (in_reply_to, created_at, id) WHERE in_reply_to IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS chirps_in_reply_to_created_at_id_idx;
+ALTER TABLE chirps DROP COLUMN IF EXISTS in_reply_to;